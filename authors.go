@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os/user"
+	"strings"
+	"time"
+)
+
+const (
+	// Creator & creation time, written by 'mdd new'
+	MetadataAuthor   = "mdd-author"
+	MetadataDateTime = "mdd-date-time"
+	// Last change made by a command such as 'mdd link' or 'mdd tag'
+	MetadataModifiedBy = "mdd-last-modified-by"
+	MetadataModifiedAt = "mdd-last-modified-at"
+
+	// Format of the times in the metadata
+	DateTimeFormat = time.RFC3339
+	// Format of the times shown by 'mdd ls -l' and on published pages
+	DisplayTimeFormat = "2006-01-02 15:04"
+)
+
+// Author returns the name of the user running mdd, from the git config if
+// available, otherwise the operating system user
+func (p *Project) Author() string {
+	if p.author == "" {
+		if out, err := runGit(p.HomePath, "config", "user.name"); err == nil && strings.TrimSpace(string(out)) != "" {
+			p.author = strings.TrimSpace(string(out))
+		} else {
+			p.author = currentAuthor()
+		}
+	}
+	return p.author
+}
+
+// currentAuthor returns the name of the operating system user running mdd
+func currentAuthor() string {
+	u, err := user.Current()
+	if err != nil {
+		return "unknown"
+	}
+	if u.Name != "" {
+		return u.Name
+	}
+	if u.Username != "" {
+		return u.Username
+	}
+	return "unknown"
+}
+
+// Touch records that the document was changed now, by the user running mdd
+func (p *Project) Touch(d *Document) {
+	d.ModifiedBy = p.Author()
+	d.ModifiedAt = time.Now().Format(DateTimeFormat)
+}
+
+// parseDateTime checks a metadata time, which may also be a date
+func parseDateTime(value string) error {
+	if _, err := time.Parse(DateTimeFormat, value); err == nil {
+		return nil
+	}
+	if _, err := time.Parse(DateFormat, value); err == nil {
+		return nil
+	}
+	return fmt.Errorf("'%s' is not a date time, expected YYYY-MM-DDThh:mm:ssZ", value)
+}
+
+// displayTime formats a metadata time for display
+func displayTime(value string) string {
+	if t, err := time.Parse(DateTimeFormat, value); err == nil {
+		return t.Local().Format(DisplayTimeFormat)
+	}
+	return value
+}
+
+// Created describes who created the document and when, eg:
+// 'created 2018-04-27 10:00 by Fred', or "" if it isnt known
+func (d *Document) Created() string {
+	return authorship("created", d.DateTime, d.Author)
+}
+
+// Modified describes who last changed the document, or "" if it hasnt been
+func (d *Document) Modified() string {
+	return authorship("modified", d.ModifiedAt, d.ModifiedBy)
+}
+
+func authorship(verb, at, by string) string {
+	s := verb
+	if at != "" {
+		s = fmt.Sprintf("%s %s", s, displayTime(at))
+	}
+	if by != "" {
+		s = fmt.Sprintf("%s by %s", s, by)
+	}
+	if s == verb {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// Directory holding the built-in version of each template the project's
+	// copy was made from, the base used by 'mdd templates upgrade'
+	TemplateBaseDir = "templates-base"
+
+	// Number of unchanged lines around each change in a diff
+	diffContext = 3
+)
+
+var shortcutRegex *regexp.Regexp
+
+func init() {
+	shortcutRegex = regexp.MustCompile("^[a-z0-9]+$")
+}
+
+// BuiltinTemplateNames returns the sorted filenames of the templates built
+// into mdd, including the html templates used by publish
+func BuiltinTemplateNames() ([]string, error) {
+	names := []string{}
+	err := box.Walk(".", func(pth string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			names = append(names, filepath.ToSlash(pth))
+		}
+		return nil
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+func isBuiltinTemplate(name string) bool {
+	names, err := BuiltinTemplateNames()
+	return err == nil && containsAny([]string{name}, names)
+}
+
+// templateFilename returns the filename of a template given its shortcut, or
+// its filename eg: 'document.html'
+func templateFilename(name string) string {
+	if filepath.Ext(name) == "" {
+		return name + ".md"
+	}
+	return name
+}
+
+func templateHash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func (p *Project) TemplateBasePath() string {
+	return filepath.Join(p.HomePath, TemplateBaseDir)
+}
+
+// recordTemplateBase saves the built-in version of a template, and its hash in
+// the config, as the base for upgrading the project's copy. The config must be
+// written by the caller
+func (p *Project) recordTemplateBase(name string, builtin []byte) error {
+	if err := os.MkdirAll(p.TemplateBasePath(), os.ModePerm); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(p.TemplateBasePath(), name), builtin, 0644); err != nil {
+		return err
+	}
+	if p.Config.Templates == nil {
+		p.Config.Templates = make(map[string]string)
+	}
+	p.Config.Templates[name] = templateHash(builtin)
+	return nil
+}
+
+// templateBase returns the recorded base version of a template, or nil if
+// there isnt one, or it doesnt match the recorded hash
+func (p *Project) templateBase(name string) []byte {
+	hash, ok := p.Config.Templates[name]
+	if !ok {
+		return nil
+	}
+	base, err := ioutil.ReadFile(filepath.Join(p.TemplateBasePath(), name))
+	if err != nil || templateHash(base) != hash {
+		return nil
+	}
+	return base
+}
+
+// AddTemplate creates a new template with the shortcut and title, and returns
+// its path
+func (p *Project) AddTemplate(shortcut, title string) (string, error) {
+	if !shortcutRegex.MatchString(shortcut) {
+		return "", fmt.Errorf("Invalid template shortcut '%s', expected lower case letters and digits", shortcut)
+	}
+	if p.FindTemplate(shortcut) != nil {
+		return "", fmt.Errorf("Template '%s' already exists", shortcut)
+	}
+	if !templateDesc.MatchString(title) || strings.HasPrefix(title, " ") {
+		return "", fmt.Errorf("Invalid template title '%s', expected letters, digits, spaces and '-.~'", title)
+	}
+	path := filepath.Join(p.TemplatePath, templateFilename(shortcut))
+	if fileExists(path) {
+		return "", fmt.Errorf("File '%s' already exists", path)
+	}
+
+	contents := []string{
+		fmt.Sprintf("# %s", title),
+		"",
+		fmt.Sprintf("The %s document captures ...", title),
+		"",
+		"**When you create a new document, delete from this line to the top of the document, and alter the example sections below to suit your situation.**",
+		"",
+		fmt.Sprintf("# TODO Place your %s title here", title),
+		"",
+		"## Section",
+		"",
+	}
+	if err := ioutil.WriteFile(path, []byte(strings.Join(contents, LineBreak)), 0644); err != nil {
+		return "", err
+	}
+	// Check the template can be read
+	if _, err := ReadTemplate(path); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// RemoveTemplate deletes a template that no documents follow
+func (p *Project) RemoveTemplate(shortcut string) error {
+	t := p.FindTemplate(shortcut)
+	if t == nil {
+		return fmt.Errorf("No such template: '%s'", shortcut)
+	}
+	users := []string{}
+	for _, d := range p.Documents {
+		if d.Template.Shortcut == shortcut {
+			users = append(users, d.BaseFilename())
+		}
+	}
+	if len(users) > 0 {
+		return fmt.Errorf("Template '%s' is used by: %s", shortcut, strings.Join(users, ", "))
+	}
+	if err := os.Remove(t.Filename); err != nil {
+		return err
+	}
+	name := filepath.Base(t.Filename)
+	if _, ok := p.Config.Templates[name]; ok {
+		os.Remove(filepath.Join(p.TemplateBasePath(), name))
+		delete(p.Config.Templates, name)
+		return p.writeConfig()
+	}
+	return nil
+}
+
+// DiffTemplate returns the changes from the built-in version of a template to
+// the project's copy, as a unified diff. An empty diff means they are the same
+func (p *Project) DiffTemplate(name string) ([]string, error) {
+	builtin, err := box.Bytes(name)
+	if err != nil {
+		return nil, fmt.Errorf("Template '%s' isnt built into mdd", name)
+	}
+	path := filepath.Join(p.TemplatePath, name)
+	local, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return unifiedDiff("built-in/"+name, filepath.ToSlash(path), strings.Split(string(builtin), LineBreak), strings.Split(string(local), LineBreak)), nil
+}
+
+// UpgradeTemplate brings the project's copy of a built-in template up to date.
+// Local changes are merged with the changes made to the built-in version since
+// the recorded base, as a three-way merge. Without a base, local changes are
+// only replaced if force is set. Returns a description of what was done, the
+// config must be written by the caller
+func (p *Project) UpgradeTemplate(name string, force bool) (string, error) {
+	builtin, err := box.Bytes(name)
+	if err != nil {
+		return "", fmt.Errorf("Template '%s' isnt built into mdd", name)
+	}
+	path := filepath.Join(p.TemplatePath, name)
+	if !fileExists(path) {
+		return "not installed, skipped", nil
+	}
+	local, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	base := p.templateBase(name)
+
+	result := ""
+	switch {
+	case base != nil && p.Config.Templates[name] == templateHash(builtin):
+		return "up to date", nil
+	case bytes.Equal(local, builtin):
+		result = "up to date"
+	case base != nil && bytes.Equal(local, base):
+		result = "upgraded"
+		err = ioutil.WriteFile(path, builtin, 0644)
+	case base != nil:
+		var conflicts int
+		conflicts, err = mergeTemplate(path, filepath.Join(p.TemplateBasePath(), name), builtin)
+		result = "merged"
+		if conflicts > 0 {
+			result = fmt.Sprintf("merged with %d conflicts, fix the lines between '<<<<<<<' and '>>>>>>>'", conflicts)
+		}
+	case force:
+		result = "replaced"
+		err = ioutil.WriteFile(path, builtin, 0644)
+	default:
+		return "has local changes and no recorded base version, skipped, use -f to replace it", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return result, p.recordTemplateBase(name, builtin)
+}
+
+// mergeTemplate merges the changes from the base to the built-in version into
+// the template at path, and returns the number of conflicts
+func mergeTemplate(path, basePath string, builtin []byte) (int, error) {
+	tmp, err := ioutil.TempFile("", "mdd-template")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(builtin); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	return gitMergeFile(path, basePath, tmp.Name(), path)
+}
+
+// diffOp is a line in a diff, kind is ' ' for an unchanged line, '-' for a
+// removed line and '+' for an added line
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// diffLines returns the edits that change before into after
+func diffLines(before, after []string) []diffOp {
+	lcs := lcsTable(before, after)
+	ops := []diffOp{}
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && before[i] == after[j]:
+			ops = append(ops, diffOp{' ', before[i]})
+			i++
+			j++
+		case i < len(before) && (j == len(after) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', before[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', after[j]})
+			j++
+		}
+	}
+	return ops
+}
+
+// unifiedDiff formats the changes from before to after like 'diff -u'
+func unifiedDiff(beforeName, afterName string, before, after []string) []string {
+	ops := diffLines(before, after)
+	out := []string{}
+	// Line numbers of ops[start], in before & after
+	beforeLine, afterLine := 1, 1
+	for start := 0; start < len(ops); {
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		// Changes closer than twice the context share a hunk
+		last := first
+		for k := first; k < len(ops) && k <= last+2*diffContext; k++ {
+			if ops[k].kind != ' ' {
+				last = k
+			}
+		}
+		from := first - diffContext
+		if from < start {
+			from = start
+		}
+		to := last + diffContext + 1
+		if to > len(ops) {
+			to = len(ops)
+		}
+
+		// Skipped lines are unchanged
+		beforeLine += from - start
+		afterLine += from - start
+		lines := []string{}
+		beforeCount, afterCount := 0, 0
+		for _, op := range ops[from:to] {
+			lines = append(lines, string(op.kind)+op.text)
+			if op.kind != '+' {
+				beforeCount++
+			}
+			if op.kind != '-' {
+				afterCount++
+			}
+		}
+		out = append(out, fmt.Sprintf("@@ -%d,%d +%d,%d @@", beforeLine, beforeCount, afterLine, afterCount))
+		out = append(out, lines...)
+		beforeLine += beforeCount
+		afterLine += afterCount
+		start = to
+	}
+	if len(out) == 0 {
+		return out
+	}
+	return append([]string{"--- " + beforeName, "+++ " + afterName}, out...)
+}
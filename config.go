@@ -0,0 +1,397 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	ConfigFile = "config.yaml"
+
+	// ID schemes, the part of a generated filename between the template
+	// shortcut and the number is a hash of the user name or the project name
+	IDSchemeUser    = "user"
+	IDSchemeProject = "project"
+)
+
+var IDSchemes = []string{IDSchemeUser, IDSchemeProject}
+
+// Config is the project configuration, stored as YAML in .mdd/config.yaml
+type Config struct {
+	Project string        `yaml:"project"`
+	Editor  string        `yaml:"editor,omitempty"`
+	Publish PublishConfig `yaml:"publish"`
+	IDs     IDConfig      `yaml:"ids"`
+	Verify  VerifyConfig  `yaml:"verify"`
+	Export  ExportConfig  `yaml:"export"`
+	// Map from template filename -> hash of the built-in version it was copied
+	// from, written by 'mdd init' & 'mdd templates upgrade'
+	Templates map[string]string `yaml:"templates,omitempty"`
+}
+
+type PublishConfig struct {
+	// Directory to publish to, relative paths are relative to the .mdd directory
+	Dir       string   `yaml:"dir"`
+	TraceRows []string `yaml:"trace-rows,flow"`
+	TraceCols []string `yaml:"trace-cols,flow"`
+}
+
+type IDConfig struct {
+	Scheme string `yaml:"scheme"`
+	Digits int    `yaml:"digits"`
+}
+
+type VerifyConfig struct {
+	// Coverage rules, eg: 'req links-to att itst'
+	Rules []string `yaml:"rules"`
+}
+
+type ExportConfig struct {
+	// Template shortcuts, in the order their documents are exported
+	Order []string `yaml:"order,flow"`
+}
+
+// DefaultConfig returns the configuration of a new project
+func DefaultConfig(name string) Config {
+	c := Config{Project: name}
+	c.setDefaults()
+	return c
+}
+
+// setDefaults fills in any settings missing from the config file
+func (c *Config) setDefaults() {
+	if c.Publish.Dir == "" {
+		c.Publish.Dir = "publish"
+	}
+	if len(c.Publish.TraceRows) == 0 {
+		c.Publish.TraceRows = DefaultTraceRows
+	}
+	if len(c.Publish.TraceCols) == 0 {
+		c.Publish.TraceCols = DefaultTraceColumns
+	}
+	if c.IDs.Scheme == "" {
+		c.IDs.Scheme = IDSchemeUser
+	}
+	if c.IDs.Digits == 0 {
+		c.IDs.Digits = 4
+	}
+	if c.Verify.Rules == nil {
+		c.Verify.Rules = []string{}
+	}
+	if c.Export.Order == nil {
+		c.Export.Order = []string{}
+	}
+}
+
+// configKey is a setting that can be read & changed with 'mdd config'
+type configKey struct {
+	Name        string
+	Description string
+	// List settings take any number of values, others exactly one
+	List bool
+	get  func(c *Config) []string
+	set  func(p *Project, values []string) error
+}
+
+var configKeys = []configKey{
+	{
+		Name:        "project",
+		Description: "Project name",
+		get:         func(c *Config) []string { return []string{c.Project} },
+		set: func(p *Project, values []string) error {
+			p.Config.Project = values[0]
+			return nil
+		},
+	},
+	{
+		Name:        "editor",
+		Description: "Command used to edit documents, overrides $EDITOR",
+		get:         func(c *Config) []string { return []string{c.Editor} },
+		set: func(p *Project, values []string) error {
+			p.Config.Editor = values[0]
+			return nil
+		},
+	},
+	{
+		Name:        "publish.dir",
+		Description: "Directory to publish the website to, relative to the .mdd directory",
+		get:         func(c *Config) []string { return []string{c.Publish.Dir} },
+		set: func(p *Project, values []string) error {
+			if err := p.checkPublishDir(values[0]); err != nil {
+				return err
+			}
+			p.Config.Publish.Dir = values[0]
+			return nil
+		},
+	},
+	{
+		Name:        "publish.trace-rows",
+		Description: "Template shortcuts used as the rows of the published traceability matrix",
+		List:        true,
+		get:         func(c *Config) []string { return c.Publish.TraceRows },
+		set: func(p *Project, values []string) error {
+			if err := p.checkShortcuts(values); err != nil {
+				return err
+			}
+			p.Config.Publish.TraceRows = values
+			return nil
+		},
+	},
+	{
+		Name:        "publish.trace-cols",
+		Description: "Template shortcuts used as the columns of the published traceability matrix",
+		List:        true,
+		get:         func(c *Config) []string { return c.Publish.TraceCols },
+		set: func(p *Project, values []string) error {
+			if err := p.checkShortcuts(values); err != nil {
+				return err
+			}
+			p.Config.Publish.TraceCols = values
+			return nil
+		},
+	},
+	{
+		Name:        "ids.scheme",
+		Description: fmt.Sprintf("Hash used in new document filenames, one of: %s", strings.Join(IDSchemes, ", ")),
+		get:         func(c *Config) []string { return []string{c.IDs.Scheme} },
+		set: func(p *Project, values []string) error {
+			if !containsAny([]string{values[0]}, IDSchemes) {
+				return fmt.Errorf("Unknown ids.scheme '%s', expected one of: %s", values[0], strings.Join(IDSchemes, ", "))
+			}
+			p.Config.IDs.Scheme = values[0]
+			return nil
+		},
+	},
+	{
+		Name:        "ids.digits",
+		Description: "Minimum number of digits in new document filenames",
+		get:         func(c *Config) []string { return []string{strconv.Itoa(c.IDs.Digits)} },
+		set: func(p *Project, values []string) error {
+			n, err := strconv.Atoi(values[0])
+			if err != nil || n < 1 || n > 9 {
+				return fmt.Errorf("Invalid ids.digits '%s', expected a number from 1 to 9", values[0])
+			}
+			p.Config.IDs.Digits = n
+			return nil
+		},
+	},
+	{
+		Name:        "verify.rules",
+		Description: "Coverage rules checked by 'mdd verify', eg: 'req links-to att itst'",
+		List:        true,
+		get:         func(c *Config) []string { return c.Verify.Rules },
+		set: func(p *Project, values []string) error {
+			for _, s := range values {
+				if _, err := ParseVerifyRule(s); err != nil {
+					return err
+				}
+			}
+			p.Config.Verify.Rules = values
+			return nil
+		},
+	},
+	{
+		Name:        "export.order",
+		Description: "Template shortcuts in the order 'mdd export' groups documents, other templates follow",
+		List:        true,
+		get:         func(c *Config) []string { return c.Export.Order },
+		set: func(p *Project, values []string) error {
+			if err := p.checkShortcuts(values); err != nil {
+				return err
+			}
+			p.Config.Export.Order = values
+			return nil
+		},
+	},
+}
+
+func findConfigKey(name string) (configKey, error) {
+	for _, k := range configKeys {
+		if k.Name == name {
+			return k, nil
+		}
+	}
+	names := []string{}
+	for _, k := range configKeys {
+		names = append(names, k.Name)
+	}
+	return configKey{}, fmt.Errorf("Unknown config key '%s', expected one of: %s", name, strings.Join(names, ", "))
+}
+
+// checkShortcuts returns an error if a shortcut doesnt match a template
+func (p *Project) checkShortcuts(shortcuts []string) error {
+	for _, s := range shortcuts {
+		if p.FindTemplate(s) == nil {
+			return fmt.Errorf("No such template: '%s'", s)
+		}
+	}
+	return nil
+}
+
+// checkPublishDir returns an error if the publish directory is, or contains, the
+// project directory, .mdd or its documents, templates or templates-base
+// directories, as 'mdd publish -f' deletes files from it
+func (p *Project) checkPublishDir(value string) error {
+	dir := value
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(p.HomePath, dir)
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	protected := []struct {
+		name string
+		path string
+	}{
+		{"project", filepath.Dir(p.HomePath)},
+		{RootDirectory, p.HomePath},
+		{"documents", p.DocumentPath},
+		{"templates", p.TemplatePath},
+		{TemplateBaseDir, p.TemplateBasePath()},
+	}
+	for _, d := range protected {
+		abs, err := filepath.Abs(d.path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, abs)
+		if err != nil {
+			continue
+		}
+		if rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("Config key 'publish.dir' cant be '%s', it contains the %s directory", value, d.name)
+		}
+	}
+	return nil
+}
+
+func (p *Project) ConfigPath() string {
+	return filepath.Join(p.HomePath, ConfigFile)
+}
+
+// GetConfig returns the values of the config key
+func (p *Project) GetConfig(name string) ([]string, error) {
+	k, err := findConfigKey(name)
+	if err != nil {
+		return nil, err
+	}
+	return k.get(&p.Config), nil
+}
+
+// SetConfig validates & changes the config key, and saves the config file
+func (p *Project) SetConfig(name string, values []string) error {
+	k, err := findConfigKey(name)
+	if err != nil {
+		return err
+	}
+	if !k.List && len(values) != 1 {
+		return fmt.Errorf("Config key '%s' takes a single value", name)
+	}
+	for _, v := range values {
+		if strings.TrimSpace(v) == "" {
+			return fmt.Errorf("Config key '%s' cant be empty", name)
+		}
+	}
+	if err := k.set(p, values); err != nil {
+		return err
+	}
+	if err := p.writeConfig(); err != nil {
+		return err
+	}
+	if name == "publish.dir" {
+		p.PublishPath = p.publishPath()
+		return os.MkdirAll(p.PublishPath, os.ModePerm)
+	}
+	return nil
+}
+
+// ListConfig returns every config key, and its values, sorted by key
+func (p *Project) ListConfig() [][]string {
+	keys := append([]configKey{}, configKeys...)
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	list := [][]string{}
+	for _, k := range keys {
+		list = append(list, append([]string{k.Name}, k.get(&p.Config)...))
+	}
+	return list
+}
+
+// publishPath returns the directory the website is published to
+func (p *Project) publishPath() string {
+	if filepath.IsAbs(p.Config.Publish.Dir) {
+		return p.Config.Publish.Dir
+	}
+	return filepath.Join(p.HomePath, p.Config.Publish.Dir)
+}
+
+func (p *Project) readConfig() error {
+	raw, err := ioutil.ReadFile(p.ConfigPath())
+	if err != nil {
+		return err
+	}
+	c := Config{}
+	if err := yaml.UnmarshalStrict(raw, &c); err != nil {
+		return fmt.Errorf("File '%s' invalid: %v", p.ConfigPath(), err)
+	}
+	c.setDefaults()
+	p.Config = c
+	return nil
+}
+
+func (p *Project) writeConfig() error {
+	raw, err := yaml.Marshal(p.Config)
+	if err != nil {
+		return err
+	}
+	header := "# mdd project configuration, change with 'mdd config set'\n"
+	return ioutil.WriteFile(p.ConfigPath(), append([]byte(header), raw...), 0644)
+}
+
+// migrateProjectDb moves the settings in a project.data file, written by older
+// versions of mdd, into the config file and removes project.data
+func (p *Project) migrateProjectDb() error {
+	if !fileExists(p.ProjectDbPath()) {
+		return nil
+	}
+	db, err := p.readProjectDb()
+	if err != nil {
+		return err
+	}
+	if fileExists(p.ConfigPath()) {
+		if err := p.readConfig(); err != nil {
+			return err
+		}
+	} else {
+		dir, err := filepath.Abs(filepath.Dir(p.HomePath))
+		if err != nil {
+			return err
+		}
+		p.Config = DefaultConfig(filepath.Base(dir))
+	}
+	if names := db[ProjectDbProject]; len(names) > 0 && names[0] != "" {
+		p.Config.Project = names[0]
+	}
+	p.Config.Verify.Rules = append(p.Config.Verify.Rules, db[ProjectDbVerifyRule]...)
+
+	if err := p.writeConfig(); err != nil {
+		return err
+	}
+	return os.Remove(p.ProjectDbPath())
+}
+
+// configKeysHelp describes each config key, for 'mdd help config'
+func configKeysHelp() string {
+	var b strings.Builder
+	for _, k := range configKeys {
+		fmt.Fprintf(&b, "\t%-20s %s\n", k.Name, k.Description)
+	}
+	return b.String()
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"crypto/md5"
 	"fmt"
+	"html/template"
 	"io"
 	"io/ioutil"
 	"log"
@@ -13,6 +15,7 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/microcosm-cc/bluemonday"
 	"gopkg.in/russross/blackfriday.v2"
@@ -21,9 +24,16 @@ import (
 const (
 	MetadataSeparator = ":"
 	MetadataChild     = "mdd-child"
+	MetadataChildType = "mdd-child-"
 	MetadataTag       = "mdd-tag"
-	MetadataStart     = "<!-- mdd"
-	MetadataEnd       = "-->"
+	MetadataStatus    = "mdd-status"
+	// Prefix of the template fields, eg: 'mdd-priority'
+	MetadataFieldPrefix = "mdd-"
+	MetadataStart       = "<!-- mdd"
+	MetadataEnd         = "-->"
+
+	// Format of the {{.Date}} placeholder
+	DateFormat = "2006-01-02"
 )
 
 type Document struct {
@@ -32,24 +42,80 @@ type Document struct {
 	Title    string
 
 	// Metadata
-	Children map[string]bool
+	Status string
+	// Children maps the child filename to the link relation, "" for an untyped link
+	Children map[string]string
 	Tags     map[string]bool
+	// Fields maps the name of a template field to its value
+	Fields map[string]string
+	// Who created the document and when, and who last changed it and when
+	Author     string
+	DateTime   string
+	ModifiedBy string
+	ModifiedAt string
 
 	// File contents
 	raw []byte
 }
 
+// Codes identifying the kind of DocumentError
+const (
+	ErrCodeFilename     = "bad-filename"
+	ErrCodeNoTemplate   = "no-template"
+	ErrCodeNoTitle      = "no-title"
+	ErrCodeNoMetadata   = "no-metadata"
+	ErrCodeMetadata     = "bad-metadata"
+	ErrCodeMissingChild = "missing-child"
+	ErrCodeRule         = "rule"
+	ErrCodeBrokenLink   = "broken-link"
+	ErrCodeInlineLink   = "inline-link"
+)
+
+// DocumentError is a problem with a single document, Code identifies the kind
+// of problem for machine readable output
+type DocumentError struct {
+	Document string
+	Code     string
+	Message  string
+}
+
+func newDocumentError(document, code, format string, a ...interface{}) *DocumentError {
+	return &DocumentError{Document: document, Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+func (e *DocumentError) Error() string {
+	return e.Message
+}
+
 // This structure is used for templates output
 type DocView struct {
 	BaseFilename     string
 	HtmlFilename     string
 	Title            string
+	Status           string
 	Tags             []string
 	Children         []string
+	Relations        map[string]string
+	Parents          []string
+	ParentRelations  map[string]string
+	Fields           []FieldView
+	Created          string
+	Modified         string
 	TemplateFilename string
 	TemplateTitle    string
 }
 
+// This structure is used for the document.html template output
+type DocumentPageView struct {
+	Doc DocView
+
+	// The document converted to sanitized HTML
+	Body template.HTML
+
+	// Map from filename -> DocView, for the children and parents of Doc
+	FilenameDocs map[string]DocView
+}
+
 var (
 	titleRegex     *regexp.Regexp
 	filenameRegex  *regexp.Regexp
@@ -58,6 +124,9 @@ var (
 	tagRegex       *regexp.Regexp
 )
 
+// LinkRelations are the relationship types a link may be qualified with
+var LinkRelations = []string{"verifies", "supersedes", "refines", "decided-in", "blocks"}
+
 func init() {
 	titleRegex = regexp.MustCompile("^# *([\\w-. ~]+) *$")
 	filenameRegex = regexp.MustCompile("^(\\w+)-(\\w+)-(\\d+)\\.md$")
@@ -71,8 +140,13 @@ func (d *Document) ForView() DocView {
 		BaseFilename:     d.BaseFilename(),
 		HtmlFilename:     d.HtmlFilename(),
 		Title:            d.Title,
+		Status:           d.Status,
 		Tags:             d.TagNames(),
 		Children:         d.ChildrenNames(),
+		Relations:        d.Children,
+		Fields:           d.FieldViews(),
+		Created:          d.Created(),
+		Modified:         d.Modified(),
 		TemplateFilename: d.Template.Filename,
 		TemplateTitle:    d.Template.Title,
 	}
@@ -86,8 +160,12 @@ func (d *Document) HtmlFilename() string {
 	return strings.Replace(d.BaseFilename(), ".md", ".html", 1)
 }
 
-func (d *Document) AddChild(child *Document) error {
-	d.Children[child.BaseFilename()] = true
+// AddChild links child to d, relation is "" for an untyped link or one of LinkRelations
+func (d *Document) AddChild(child *Document, relation string) error {
+	if !validRelation(relation) {
+		return fmt.Errorf("Unknown link relation '%s', expected one of: %s", relation, strings.Join(LinkRelations, ", "))
+	}
+	d.Children[child.BaseFilename()] = relation
 	return nil
 }
 
@@ -98,7 +176,25 @@ func (d *Document) RemoveChild(childFilename string) error {
 
 func (d *Document) HasChild(child *Document) bool {
 	// log.Printf("%s has child %s == %t", d.BaseFilename(), child.BaseFilename(), d.Children[child.BaseFilename()])
-	return d.Children[child.BaseFilename()] == true
+	_, ok := d.Children[child.BaseFilename()]
+	return ok
+}
+
+// Relation returns the relation of the link to childFilename, "" if untyped
+func (d *Document) Relation(childFilename string) string {
+	return d.Children[childFilename]
+}
+
+func validRelation(relation string) bool {
+	if relation == "" {
+		return true
+	}
+	for _, r := range LinkRelations {
+		if r == relation {
+			return true
+		}
+	}
+	return false
 }
 
 func (d *Document) Tag(tag string) error {
@@ -133,17 +229,31 @@ func (d *Document) ChildrenNames() []string {
 }
 
 func (p *Project) ReadDocument(path string) (*Document, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		base := filepath.Base(path)
+		if !filenameRegex.MatchString(base) {
+			return nil, newDocumentError(base, ErrCodeFilename, "Document '%s' doesnt match mdd filename regex", base)
+		}
+		return nil, err
+	}
+	return p.ParseDocument(path, raw)
+}
+
+// ParseDocument parses the contents of a document, path is used for its filename
+func (p *Project) ParseDocument(path string, raw []byte) (*Document, error) {
 
 	d := Document{
 		Filename: path,
-		Children: make(map[string]bool),
+		Children: make(map[string]string),
 		Tags:     make(map[string]bool),
+		Fields:   make(map[string]string),
 	}
 
 	base := filepath.Base(path)
 	matches := filenameRegex.FindStringSubmatch(base)
 	if len(matches) != 4 {
-		return nil, fmt.Errorf("Document '%s' doesnt match mdd filename regex", base)
+		return nil, newDocumentError(base, ErrCodeFilename, "Document '%s' doesnt match mdd filename regex", base)
 	}
 
 	for _, t := range p.Templates {
@@ -153,14 +263,10 @@ func (p *Project) ReadDocument(path string) (*Document, error) {
 		}
 	}
 	if d.Template == nil {
-		return nil, fmt.Errorf("Document '%s' no template matching shortcode '%s'", base, matches[1])
+		return nil, newDocumentError(base, ErrCodeNoTemplate, "Document '%s' no template matching shortcode '%s'", base, matches[1])
 	}
 
-	var err error
-	d.raw, err = ioutil.ReadFile(path)
-	if err != nil {
-		return &d, err
-	}
+	d.raw = raw
 	content := string(d.raw)
 	contents := strings.Split(content, LineBreak)
 
@@ -173,7 +279,7 @@ func (p *Project) ReadDocument(path string) (*Document, error) {
 		}
 	}
 	if d.Title == "" {
-		return nil, fmt.Errorf("Document '%s' has no title", base)
+		return nil, newDocumentError(base, ErrCodeNoTitle, "Document '%s' has no title", base)
 	}
 
 	// Read the metadata
@@ -198,7 +304,7 @@ func (p *Project) ReadDocument(path string) (*Document, error) {
 		}
 	}
 	if !(foundMetadataStart && foundMetadataEnd) {
-		return &d, fmt.Errorf("Document '%s' missing metadata block", base)
+		return &d, newDocumentError(base, ErrCodeNoMetadata, "Document '%s' missing metadata block", base)
 	}
 	return &d, nil
 }
@@ -208,7 +314,7 @@ func (d *Document) Delete() error {
 }
 
 func (d *Document) WriteDocument() error {
-	file, err := os.OpenFile(d.Filename, os.O_RDWR, 0644)
+	file, err := os.OpenFile(d.Filename, os.O_RDWR|os.O_TRUNC, 0644)
 	if err != nil {
 		return err
 	}
@@ -236,38 +342,80 @@ func (d *Document) WriteDocument() error {
 func (d *Document) metadataForWrite() []string {
 	meta := []string{MetadataStart}
 
-	for key := range d.Children {
-		meta = append(meta, fmt.Sprintf("%s: %s", MetadataChild, key))
+	if d.Status != "" {
+		meta = append(meta, fmt.Sprintf("%s: %s", MetadataStatus, d.Status))
+	}
+	for _, kv := range [][]string{{MetadataAuthor, d.Author}, {MetadataDateTime, d.DateTime}, {MetadataModifiedBy, d.ModifiedBy}, {MetadataModifiedAt, d.ModifiedAt}} {
+		if kv[1] != "" {
+			meta = append(meta, fmt.Sprintf("%s: %s", kv[0], kv[1]))
+		}
+	}
+	for _, key := range d.ChildrenNames() {
+		if relation := d.Children[key]; relation != "" {
+			meta = append(meta, fmt.Sprintf("%s%s: %s", MetadataChildType, relation, key))
+		} else {
+			meta = append(meta, fmt.Sprintf("%s: %s", MetadataChild, key))
+		}
 	}
-	for key := range d.Tags {
+	for _, key := range d.TagNames() {
 		meta = append(meta, fmt.Sprintf("%s: %s", MetadataTag, key))
 	}
+	for _, key := range d.FieldNames() {
+		meta = append(meta, fmt.Sprintf("%s%s: %s", MetadataFieldPrefix, key, d.Fields[key]))
+	}
 	meta = append(meta, MetadataEnd)
 	return meta
 }
 
 // line has one of the forms:
 // mdd-child:document-name
+// mdd-child-relation:document-name
 // mdd-tag:value
+// mdd-status:value
+// mdd-author:value, mdd-date-time:value
+// mdd-last-modified-by:value, mdd-last-modified-at:value
+// mdd-name:value, for each field declared by the template
 func (d *Document) parseMetadata(line string) error {
 
-	meta := strings.Split(line, MetadataSeparator)
+	meta := strings.SplitN(line, MetadataSeparator, 2)
 	if len(meta) != 2 {
-		return fmt.Errorf("Document '%s' expected 2 values, found %d from metadata '%s'", d.BaseFilename(), len(meta), line)
+		return newDocumentError(d.BaseFilename(), ErrCodeMetadata, "Document '%s' expected 2 values, found %d from metadata '%s'", d.BaseFilename(), len(meta), line)
 	}
 
 	key := strings.TrimSpace(meta[0])
 	value := strings.TrimSpace(meta[1])
 	if value == "" {
-		return fmt.Errorf("Document '%s' metadata value for key '%s' is empty", d.BaseFilename(), key)
+		return newDocumentError(d.BaseFilename(), ErrCodeMetadata, "Document '%s' metadata value for key '%s' is empty", d.BaseFilename(), key)
 	}
-	switch key {
-	case MetadataChild:
-		d.Children[value] = true
-	case MetadataTag:
+	switch {
+	case key == MetadataChild:
+		d.Children[value] = ""
+	case strings.HasPrefix(key, MetadataChildType) && key != MetadataChildType && validRelation(strings.TrimPrefix(key, MetadataChildType)):
+		d.Children[value] = strings.TrimPrefix(key, MetadataChildType)
+	case key == MetadataTag:
 		d.Tags[value] = true
+	case key == MetadataStatus:
+		if !validStatus(value) {
+			return newDocumentError(d.BaseFilename(), ErrCodeMetadata, "Document '%s' unknown status '%s'", d.BaseFilename(), value)
+		}
+		d.Status = value
+	case key == MetadataAuthor:
+		d.Author = value
+	case key == MetadataModifiedBy:
+		d.ModifiedBy = value
+	case key == MetadataDateTime || key == MetadataModifiedAt:
+		if err := parseDateTime(value); err != nil {
+			return newDocumentError(d.BaseFilename(), ErrCodeMetadata, "Document '%s' metadata '%s' is invalid, %v", d.BaseFilename(), key, err)
+		}
+		if key == MetadataDateTime {
+			d.DateTime = value
+		} else {
+			d.ModifiedAt = value
+		}
+	case strings.HasPrefix(key, MetadataFieldPrefix) && d.Template != nil && d.Template.FindField(strings.TrimPrefix(key, MetadataFieldPrefix)) != nil:
+		d.Fields[strings.TrimPrefix(key, MetadataFieldPrefix)] = value
 	default:
-		return fmt.Errorf("Document '%s' unrecognised metadata tag '%s'", d.BaseFilename(), key)
+		return newDocumentError(d.BaseFilename(), ErrCodeMetadata, "Document '%s' unrecognised metadata tag '%s'", d.BaseFilename(), key)
 	}
 	return nil
 }
@@ -278,32 +426,85 @@ func (p *Project) NewDocument(t *Template, title string) (Document, error) {
 		Filename: filepath.Join(p.DocumentPath, p.GenerateFilename(t)),
 		Template: t,
 		Title:    title,
+		Children: make(map[string]string),
+		Tags:     make(map[string]bool),
+		Fields:   make(map[string]string),
 	}
 
-	f, err := os.Create(d.Filename)
-	if err != nil {
-		return d, err
+	// Expand the placeholders in the template
+	view := PlaceholderView{
+		Title:    title,
+		ID:       strings.TrimSuffix(d.BaseFilename(), ".md"),
+		Filename: d.BaseFilename(),
+		Author:   p.Author(),
+		Date:     time.Now().Format(DateFormat),
+		Project:  p.Config.Project,
 	}
-	defer f.Close()
+	if view.Title == "" {
+		view.Title = t.Title
+	}
+	contents := t.Expand(view)
 
 	// Don't replace the title unless a new one supplied
 	replacedTitle := false || title == ""
 
-	for _, l := range t.Contents {
+	lines := []string{}
+	inMeta := false
+	for _, l := range contents {
+		// Metadata in the template is added to the metadata section
+		if inMeta {
+			if metaEndRegex.MatchString(l) {
+				inMeta = false
+			} else if strings.TrimSpace(l) != "" {
+				if err := d.parseMetadata(l); err != nil {
+					return d, err
+				}
+			}
+			continue
+		}
+		if metaStartRegex.MatchString(l) {
+			inMeta = true
+			if n := len(lines); n > 0 && strings.TrimSpace(lines[n-1]) == "" {
+				lines = lines[:n-1]
+			}
+			continue
+		}
 		if !replacedTitle {
 			if titleRegex.MatchString(l) {
 				l = fmt.Sprintf("# %s", d.Title)
 				replacedTitle = true
 			}
 		}
+		lines = append(lines, l)
+	}
+
+	f, err := os.Create(d.Filename)
+	if err != nil {
+		return d, err
+	}
+	defer f.Close()
+
+	for _, l := range lines {
 		_, err = f.WriteString(fmt.Sprintf("%s\n", l))
 		if err != nil {
 			return d, err
 		}
 	}
 
-	// Write metadata section
-	_, err = f.WriteString(fmt.Sprintf("\n%s\n%s\n", MetadataStart, MetadataEnd))
+	// Fields not set by the template metadata start with their defaults
+	for _, field := range t.Fields {
+		if _, ok := d.Fields[field.Name]; !ok && field.Default != "" {
+			d.Fields[field.Name] = field.Default
+		}
+	}
+
+	// Write metadata section, new documents start as drafts
+	if d.Status == "" {
+		d.Status = StatusDraft
+	}
+	d.Author = p.Author()
+	d.DateTime = time.Now().Format(DateTimeFormat)
+	_, err = f.WriteString(fmt.Sprintf("\n%s\n", strings.Join(d.metadataForWrite(), LineBreak)))
 	if err != nil {
 		return d, err
 	}
@@ -312,10 +513,20 @@ func (p *Project) NewDocument(t *Template, title string) (Document, error) {
 }
 
 // GenerateFilename finds the next free filename for a given template
-// and injects 3 chars from the USER envar to minimise classhes
+// and injects a hash of the user or project name, depending on the
+// ids.scheme config, to minimise classhes
 func (p *Project) GenerateFilename(t *Template) string {
+	filename := p.documentFilename(t, p.maxNumber()+1)
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return filename
+	}
+	panic(fmt.Sprintf("GenerateFilename returning a file that already exists: '%s'", filename))
+}
+
+// maxNumber returns the highest number used in a document filename
+func (p *Project) maxNumber() int {
 	max := 0
-	err := filepath.Walk(p.DocumentPath, func(path string, info os.FileInfo, err error) error {
+	filepath.Walk(p.DocumentPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			log.Printf("Ignore failure accessing a path %q: %v\n", path, err)
 			return err
@@ -340,38 +551,57 @@ func (p *Project) GenerateFilename(t *Template) string {
 		}
 		return nil
 	})
+	return max
+}
+
+// documentFilename returns the filename of a document using the template,
+// with the number, eg: req-b7-0012.md
+func (p *Project) documentFilename(t *Template, number int) string {
 	// Turn username into a semi-unique part of the filename
 	// to help avoid filename clashes
-	u, err := user.Current()
-	if err != nil || u.Username == "" {
-		u = &user.User{Username: "unknown"}
-	}
 	h := md5.New()
-	io.WriteString(h, u.Username)
-
-	filename := fmt.Sprintf("%s-%x-%04d.md", t.Shortcut, h.Sum(nil)[0:1], max+1)
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		return filename
+	if p.Config.IDs.Scheme == IDSchemeProject {
+		io.WriteString(h, p.Config.Project)
+	} else {
+		u, err := user.Current()
+		if err != nil || u.Username == "" {
+			u = &user.User{Username: "unknown"}
+		}
+		io.WriteString(h, u.Username)
 	}
-	panic(fmt.Sprintf("GenerateFilename returning a file that already exists: '%s'", filename))
-}
 
-// Write the output as HTML
-func (d *Document) ConvertToHTML(outPath string) error {
+	return fmt.Sprintf("%s-%x-%0*d.md", t.Shortcut, h.Sum(nil)[0:1], p.Config.IDs.Digits, number)
+}
 
-	unsafe := blackfriday.Run(d.raw)
-	html := bluemonday.UGCPolicy().SanitizeBytes(unsafe)
+// HTML converts the markdown to sanitized HTML, inline links to the documents
+// in docs are pointed at their HTML pages
+func (d *Document) HTML(docs map[string]DocView) []byte {
+	r := &linkRenderer{
+		HTMLRenderer: blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{Flags: blackfriday.CommonHTMLFlags}),
+		docs:         docs,
+	}
+	unsafe := blackfriday.Run(d.raw, blackfriday.WithRenderer(r))
+	return bluemonday.UGCPolicy().SanitizeBytes(unsafe)
+}
 
-	outFile := path.Join(outPath, d.HtmlFilename())
-	_, err := os.Stat(outFile)
-	if !os.IsNotExist(err) {
-		return fmt.Errorf("ConvertToHTML, file '%s' already exists", outFile)
+// Page renders the document as a complete HTML page with tmpl, docs maps
+// filename -> DocView for every document in the project
+func (d *Document) Page(tmpl *template.Template, docs map[string]DocView) ([]byte, error) {
+	view := DocumentPageView{
+		Doc:          docs[d.BaseFilename()],
+		Body:         template.HTML(d.HTML(docs)),
+		FilenameDocs: docs,
 	}
-	file, err := os.OpenFile(outFile, os.O_CREATE|os.O_RDWR, 0644)
+	var b bytes.Buffer
+	err := tmpl.Execute(&b, view)
+	return b.Bytes(), err
+}
+
+// Write the output as a HTML page, replacing any existing file
+func (d *Document) ConvertToHTML(tmpl *template.Template, docs map[string]DocView, outPath string) error {
+	page, err := d.Page(tmpl, docs)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	_, err = file.Write(html)
-	return err
+	return ioutil.WriteFile(path.Join(outPath, d.HtmlFilename()), page, 0644)
 }
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/microcosm-cc/bluemonday"
+	"gopkg.in/russross/blackfriday.v2"
+)
+
+const (
+	// Template for the page written by 'mdd export -format html'
+	ExportHTMLFile = "export.html"
+
+	ExportMarkdown = "md"
+	ExportHTML     = "html"
+	ExportEPUB     = "epub"
+
+	// Anchor of the traceability appendix
+	exportTraceAnchor = "appendix-traceability"
+)
+
+var ExportFormats = []string{ExportMarkdown, ExportHTML, ExportEPUB}
+
+// ExportGroup is the documents following a template, in an export
+type ExportGroup struct {
+	Template  *Template
+	Documents []*Document
+}
+
+// This structure is used for the export.html template output
+type ExportView struct {
+	Project   string
+	Exported  string
+	Documents int
+
+	// The combined documents converted to sanitized HTML
+	Body template.HTML
+}
+
+// exportAnchor returns the anchor that links to the document in an export
+func exportAnchor(d *Document) string {
+	return strings.TrimSuffix(d.BaseFilename(), ".md")
+}
+
+func exportTemplateAnchor(t *Template) string {
+	return "template-" + t.Shortcut
+}
+
+// ExportGroups returns the documents grouped by template. The templates in the
+// export.order config come first, in that order, followed by the others. Templates
+// without documents are left out
+func (p *Project) ExportGroups() []ExportGroup {
+	templates := []*Template{}
+	for _, s := range p.Config.Export.Order {
+		if t := p.FindTemplate(s); t != nil {
+			templates = append(templates, t)
+		}
+	}
+	for i := range p.Templates {
+		if !containsAny([]string{p.Templates[i].Shortcut}, p.Config.Export.Order) {
+			templates = append(templates, &p.Templates[i])
+		}
+	}
+	groups := []ExportGroup{}
+	for _, t := range templates {
+		g := ExportGroup{Template: t}
+		for _, d := range p.Documents {
+			if d.Template.Shortcut == t.Shortcut {
+				g.Documents = append(g.Documents, d)
+			}
+		}
+		if len(g.Documents) > 0 {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// ExportMarkdown combines every document into a single markdown document, with
+// a table of contents, and an appendix holding the traceability matrix. Inline
+// links between documents are pointed at the anchor before each document
+func (p *Project) ExportMarkdown() []byte {
+	var b bytes.Buffer
+	groups := p.ExportGroups()
+
+	fmt.Fprintf(&b, "# %s\n\n", p.Config.Project)
+	b.WriteString("## Contents\n\n")
+	for _, g := range groups {
+		fmt.Fprintf(&b, "- [%s](#%s)\n", g.Template.Title, exportTemplateAnchor(g.Template))
+		for _, d := range g.Documents {
+			fmt.Fprintf(&b, "    - [%s %s](#%s)\n", exportAnchor(d), d.Title, exportAnchor(d))
+		}
+	}
+	fmt.Fprintf(&b, "- [Appendix: Traceability](#%s)\n", exportTraceAnchor)
+
+	for _, g := range groups {
+		fmt.Fprintf(&b, "\n<a id=\"%s\"></a>\n\n# %s\n", exportTemplateAnchor(g.Template), g.Template.Title)
+		for _, d := range g.Documents {
+			b.WriteString("\n")
+			p.exportDocument(&b, d)
+		}
+	}
+
+	fmt.Fprintf(&b, "\n<a id=\"%s\"></a>\n\n# Appendix: Traceability\n\n", exportTraceAnchor)
+	p.exportTrace(&b)
+	return b.Bytes()
+}
+
+// exportDocument writes the document body, after a heading with its anchor and
+// a line with its filename, status & links. The document headings are moved
+// down a level, so they sit below the template heading
+func (p *Project) exportDocument(b *bytes.Buffer, d *Document) {
+	fmt.Fprintf(b, "<a id=\"%s\"></a>\n\n## %s\n\n", exportAnchor(d), d.Title)
+	fmt.Fprintf(b, "*%s, status: %s*\n", d.BaseFilename(), d.Status)
+	if len(d.Children) > 0 {
+		links := []string{}
+		for _, name := range d.ChildrenNames() {
+			link := name
+			if c := p.FindDocument(name); c != nil {
+				link = fmt.Sprintf("[%s](#%s)", exportAnchor(c), exportAnchor(c))
+			}
+			if relation := d.Relation(name); relation != "" {
+				link = fmt.Sprintf("%s (%s)", link, relation)
+			}
+			links = append(links, link)
+		}
+		fmt.Fprintf(b, "\nLinks to: %s\n", strings.Join(links, ", "))
+	}
+
+	lines := strings.Split(strings.TrimSpace(d.Body()), LineBreak)
+	inFence := false
+	titleSeen := false
+	out := []string{}
+	for _, l := range lines {
+		if fenceRegex.MatchString(l) {
+			inFence = !inFence
+		} else if !inFence {
+			if !titleSeen && titleRegex.MatchString(l) {
+				// Replaced by the heading above
+				titleSeen = true
+				continue
+			}
+			if matches := headingRegex.FindStringSubmatch(l); matches != nil && len(matches[1]) < 6 {
+				l = "#" + l
+			}
+			l = p.exportLinks(l)
+		}
+		out = append(out, l)
+	}
+	body := strings.TrimSpace(strings.Join(out, LineBreak))
+	if body != "" {
+		fmt.Fprintf(b, "\n%s\n", body)
+	}
+}
+
+// exportLinks points the inline links to documents in the line at their anchors
+func (p *Project) exportLinks(line string) string {
+	return importLinkRegex.ReplaceAllStringFunc(line, func(match string) string {
+		m := importLinkRegex.FindStringSubmatch(match)
+		link, ok := parseInlineLink(m[2])
+		if !ok {
+			return match
+		}
+		d := p.FindDocument(link.Filename)
+		if d == nil {
+			return match
+		}
+		return m[1] + "#" + exportAnchor(d)
+	})
+}
+
+// exportTrace writes the traceability matrix, from the publish.trace-rows &
+// publish.trace-cols config, as a markdown table
+func (p *Project) exportTrace(b *bytes.Buffer) {
+	m := p.TraceMatrix(p.Config.Publish.TraceRows, p.Config.Publish.TraceCols)
+	if len(m.Rows) == 0 {
+		b.WriteString("No requirements!\n")
+		return
+	}
+	header := "| Document | Title |"
+	separator := "| --- | --- |"
+	for _, c := range m.Columns {
+		header += fmt.Sprintf(" [%s](#%s) |", exportAnchor(c), exportAnchor(c))
+		separator += " --- |"
+	}
+	fmt.Fprintf(b, "%s\n%s\n", header, separator)
+	for _, r := range m.Rows {
+		row := fmt.Sprintf("| [%s](#%s) | %s |", exportAnchor(r), exportAnchor(r), r.Title)
+		for _, c := range m.Columns {
+			mark := ""
+			if m.Links[r.BaseFilename()][c.BaseFilename()] {
+				mark = TraceMark
+			}
+			row += fmt.Sprintf(" %s |", mark)
+		}
+		fmt.Fprintf(b, "%s\n", row)
+	}
+	fmt.Fprintf(b, "\n%s\n", m.CoverageSummary())
+}
+
+// exportBody converts the combined markdown to sanitized HTML
+func (p *Project) exportBody() []byte {
+	r := blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{Flags: blackfriday.CommonHTMLFlags})
+	unsafe := blackfriday.Run(p.ExportMarkdown(), blackfriday.WithRenderer(r))
+	return bluemonday.UGCPolicy().SanitizeBytes(unsafe)
+}
+
+// ExportHTML combines every document into a single HTML page, rendered with
+// the export.html template
+func (p *Project) ExportHTML() ([]byte, error) {
+	view := ExportView{
+		Project:   p.Config.Project,
+		Exported:  time.Now().Format(DateTimeFormat),
+		Documents: len(p.Documents),
+		Body:      template.HTML(p.exportBody()),
+	}
+	return p.renderHTMLTemplate(ExportHTMLFile, view)
+}
+
+// WriteEPUB combines every document into an EPUB book, with a single chapter
+// holding the HTML export and a navigation document listing each document
+func (p *Project) WriteEPUB(w io.Writer) error {
+	z := zip.NewWriter(w)
+
+	// The mimetype must be first, and not compressed
+	f, err := z.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, "application/epub+zip"); err != nil {
+		return err
+	}
+
+	var nav bytes.Buffer
+	nav.WriteString("<ol>\n")
+	for _, g := range p.ExportGroups() {
+		fmt.Fprintf(&nav, "<li><a href=\"content.xhtml#%s\">%s</a>\n<ol>\n", exportTemplateAnchor(g.Template), template.HTMLEscapeString(g.Template.Title))
+		for _, d := range g.Documents {
+			fmt.Fprintf(&nav, "<li><a href=\"content.xhtml#%s\">%s %s</a></li>\n", exportAnchor(d), exportAnchor(d), template.HTMLEscapeString(d.Title))
+		}
+		nav.WriteString("</ol>\n</li>\n")
+	}
+	fmt.Fprintf(&nav, "<li><a href=\"content.xhtml#%s\">Appendix: Traceability</a></li>\n</ol>", exportTraceAnchor)
+
+	title := template.HTMLEscapeString(p.Config.Project)
+	files := []struct {
+		name     string
+		contents string
+	}{
+		{"META-INF/container.xml", `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`},
+		{"OEBPS/content.opf", fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="id">urn:mdd:%s</dc:identifier>
+    <dc:title>%s</dc:title>
+    <dc:language>en</dc:language>
+    <meta property="dcterms:modified">%s</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="content" href="content.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine>
+    <itemref idref="content"/>
+  </spine>
+</package>
+`, title, title, time.Now().UTC().Format("2006-01-02T15:04:05Z"))},
+		{"OEBPS/nav.xhtml", fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>%s</title></head>
+<body>
+<nav epub:type="toc">
+<h1>Contents</h1>
+%s
+</nav>
+</body>
+</html>
+`, title, nav.String())},
+		{"OEBPS/content.xhtml", fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>%s</title></head>
+<body>
+%s
+</body>
+</html>
+`, title, p.exportBody())},
+	}
+	for _, file := range files {
+		f, err := z.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, file.contents); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	MetadataField = "mdd-field"
+
+	FieldString = "string"
+	FieldInt    = "int"
+	FieldDate   = "date"
+	FieldEnum   = "enum"
+	FieldDocRef = "doc-ref"
+
+	ErrCodeField = "field"
+)
+
+// FieldTypes are the types a template field may have, an enum lists its values
+// eg: enum(low,medium,high)
+var FieldTypes = []string{FieldString, FieldInt, FieldDate, FieldEnum, FieldDocRef}
+
+// Names used by the built in metadata, that fields cant use
+var reservedFieldNames = []string{"child", "tag", "status", "field", "transition", "template", "section", "author", "date-time", "last-modified-by", "last-modified-at"}
+
+var (
+	fieldNameRegex *regexp.Regexp
+	fieldEnumRegex *regexp.Regexp
+)
+
+func init() {
+	fieldNameRegex = regexp.MustCompile("^[a-z][a-z0-9-]*$")
+	fieldEnumRegex = regexp.MustCompile("^enum\\(([^)]*)\\)$")
+}
+
+// Field is a custom metadata field declared by a template, stored in documents
+// as 'mdd-name: value'
+type Field struct {
+	Name string
+	Type string
+	// Values allowed for an enum
+	Values   []string
+	Required bool
+	Default  string
+}
+
+// This structure is used for the document.html template output
+type FieldView struct {
+	Name  string
+	Value string
+	// Value is the filename of a document
+	Ref bool
+}
+
+// parseField parses a template field of the form 'name type [required] [default=value]'
+func (t *Template) parseField(value string) error {
+	words := strings.Fields(value)
+	if len(words) < 2 {
+		return fmt.Errorf("Template '%s' invalid field '%s', expected 'name type [required] [default=value]'", t.Filename, value)
+	}
+	f := Field{Name: words[0], Type: words[1]}
+	if !fieldNameRegex.MatchString(f.Name) || containsAny([]string{f.Name}, reservedFieldNames) || strings.HasPrefix(f.Name, "child-") {
+		return fmt.Errorf("Template '%s' invalid field name '%s'", t.Filename, f.Name)
+	}
+	if t.FindField(f.Name) != nil {
+		return fmt.Errorf("Template '%s' field '%s' declared twice", t.Filename, f.Name)
+	}
+	if matches := fieldEnumRegex.FindStringSubmatch(f.Type); matches != nil {
+		f.Type = FieldEnum
+		for _, v := range strings.Split(matches[1], ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				f.Values = append(f.Values, v)
+			}
+		}
+		if len(f.Values) == 0 {
+			return fmt.Errorf("Template '%s' field '%s' enum has no values", t.Filename, f.Name)
+		}
+	} else if f.Type == FieldEnum || !containsAny([]string{f.Type}, FieldTypes) {
+		return fmt.Errorf("Template '%s' field '%s' unknown type '%s', expected one of: string, int, date, enum(a,b,...), doc-ref", t.Filename, f.Name, f.Type)
+	}
+	for _, w := range words[2:] {
+		switch {
+		case w == "required":
+			f.Required = true
+		case strings.HasPrefix(w, "default="):
+			f.Default = strings.TrimPrefix(w, "default=")
+			if err := f.checkValue(f.Default); err != nil {
+				return fmt.Errorf("Template '%s' field '%s' invalid default, %v", t.Filename, f.Name, err)
+			}
+		default:
+			return fmt.Errorf("Template '%s' field '%s' unknown option '%s'", t.Filename, f.Name, w)
+		}
+	}
+	t.Fields = append(t.Fields, f)
+	return nil
+}
+
+// FindField returns the field declared by the template, or nil
+func (t *Template) FindField(name string) *Field {
+	for i := range t.Fields {
+		if t.Fields[i].Name == name {
+			return &t.Fields[i]
+		}
+	}
+	return nil
+}
+
+// FieldNames returns the names of the fields in the order they are declared
+func (t *Template) FieldNames() []string {
+	names := []string{}
+	for _, f := range t.Fields {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+// checkValue returns an error if value isnt valid for the field's type, doc-ref
+// fields are checked against the project by Validate
+func (f *Field) checkValue(value string) error {
+	switch f.Type {
+	case FieldInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("'%s' is not an int", value)
+		}
+	case FieldDate:
+		if _, err := time.Parse(DateFormat, value); err != nil {
+			return fmt.Errorf("'%s' is not a date, expected YYYY-MM-DD", value)
+		}
+	case FieldEnum:
+		if !containsAny([]string{value}, f.Values) {
+			return fmt.Errorf("'%s' is not one of: %s", value, strings.Join(f.Values, ", "))
+		}
+	case FieldDocRef:
+		if !filenameRegex.MatchString(value) {
+			return fmt.Errorf("'%s' is not a document filename", value)
+		}
+	}
+	return nil
+}
+
+// Validate returns an error if value isnt valid for the field
+func (f *Field) Validate(p *Project, value string) error {
+	if err := f.checkValue(value); err != nil {
+		return err
+	}
+	if f.Type == FieldDocRef && p.FindDocument(value) == nil {
+		return fmt.Errorf("'%s' doesnt exist", value)
+	}
+	return nil
+}
+
+// SetField validates value and sets the field on the document
+func (p *Project) SetField(d *Document, name, value string) error {
+	f := d.Template.FindField(name)
+	if f == nil {
+		if len(d.Template.Fields) == 0 {
+			return fmt.Errorf("Template '%s' has no fields", d.Template.Shortcut)
+		}
+		return fmt.Errorf("Template '%s' has no field '%s', expected one of: %s", d.Template.Shortcut, name, strings.Join(d.Template.FieldNames(), ", "))
+	}
+	if f.Type == FieldDocRef {
+		value = withMdSuffix(value)
+	}
+	if err := f.Validate(p, value); err != nil {
+		return fmt.Errorf("Invalid %s field '%s', %v", f.Type, name, err)
+	}
+	d.Fields[name] = value
+	return nil
+}
+
+// CheckFields returns an error for each required field missing from the
+// document, and each field with an invalid value
+func (p *Project) CheckFields(d *Document) []error {
+	errs := []error{}
+	for _, f := range d.Template.Fields {
+		value, ok := d.Fields[f.Name]
+		if !ok {
+			if f.Required {
+				errs = append(errs, newDocumentError(d.BaseFilename(), ErrCodeField, "Document '%s' missing required field '%s'", d.BaseFilename(), f.Name))
+			}
+			continue
+		}
+		if err := f.Validate(p, value); err != nil {
+			errs = append(errs, newDocumentError(d.BaseFilename(), ErrCodeField, "Document '%s' field '%s' is invalid, %v", d.BaseFilename(), f.Name, err))
+		}
+	}
+	return errs
+}
+
+// FieldViews returns the fields set on the document, in template order
+func (d *Document) FieldViews() []FieldView {
+	views := []FieldView{}
+	for _, f := range d.Template.Fields {
+		if value, ok := d.Fields[f.Name]; ok {
+			views = append(views, FieldView{Name: f.Name, Value: value, Ref: f.Type == FieldDocRef})
+		}
+	}
+	return views
+}
+
+// FieldNames returns the names of the fields set on the document, in template
+// order
+func (d *Document) FieldNames() []string {
+	names := []string{}
+	for _, name := range d.Template.FieldNames() {
+		if _, ok := d.Fields[name]; ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	// Relations between documents used in where expressions
+	FilterLinksTo     = "links-to"
+	FilterLinkedFrom  = "linked-from"
+	FilterLinkedTo    = "linked-to"
+	FilterReaches     = "reaches"
+	FilterReachedFrom = "reached-from"
+)
+
+// FilterNames are the document properties a where expression can test, as well
+// as the fields declared by the templates
+var FilterNames = []string{"template", "tag", "status", "title", "filename", "author"}
+
+// FilterRelations are the functions that test the documents linked to a document
+var FilterRelations = []string{FilterLinksTo, FilterLinkedFrom, FilterLinkedTo, FilterReaches, FilterReachedFrom}
+
+// Filter is a parsed where expression, eg:
+// template=req and tag=security and not linked-to(template=att)
+type Filter struct {
+	Expr  string
+	match func(d *Document) bool
+}
+
+// Match returns true if the document passes the filter
+func (f *Filter) Match(d *Document) bool {
+	return f.match(d)
+}
+
+// Filter returns the documents that pass the filter, in project order
+func (p *Project) Filter(f *Filter) []*Document {
+	docs := []*Document{}
+	for _, d := range p.Documents {
+		if f == nil || f.Match(d) {
+			docs = append(docs, d)
+		}
+	}
+	return docs
+}
+
+// filterToken is a word, quoted value, operator or bracket in a where expression
+type filterToken struct {
+	Text   string
+	Quoted bool
+}
+
+// filterParser is a recursive descent parser for the grammar:
+//
+//	expr   := term { 'or' term }
+//	term   := factor { 'and' factor }
+//	factor := 'not' factor | '(' expr ')' | relation '(' expr ')' | name op value
+//	op     := '=' | '!=' | '~'
+type filterParser struct {
+	p      *Project
+	expr   string
+	tokens []filterToken
+	pos    int
+}
+
+// ParseFilter parses a where expression, names that arent one of FilterNames
+// must be a field declared by one of the project templates
+func (p *Project) ParseFilter(s string) (*Filter, error) {
+	tokens, err := tokenizeFilter(s)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid where expression '%s', %v", s, err)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("Invalid where expression '%s', it is empty", s)
+	}
+	fp := &filterParser{p: p, expr: s, tokens: tokens}
+	match, err := fp.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if fp.pos < len(fp.tokens) {
+		return nil, fp.errorf("unexpected '%s'", fp.tokens[fp.pos].Text)
+	}
+	return &Filter{Expr: s, match: match}, nil
+}
+
+// tokenizeFilter splits s into words, "quoted values", operators and brackets
+func tokenizeFilter(s string) ([]filterToken, error) {
+	tokens := []filterToken{}
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')' || r == '=' || r == '~':
+			tokens = append(tokens, filterToken{Text: string(r)})
+			i++
+		case r == '!':
+			if i+1 >= len(runes) || runes[i+1] != '=' {
+				return tokens, fmt.Errorf("expected '!=' at position %d", i+1)
+			}
+			tokens = append(tokens, filterToken{Text: "!="})
+			i += 2
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end >= len(runes) {
+				return tokens, fmt.Errorf("unterminated quote at position %d", i+1)
+			}
+			tokens = append(tokens, filterToken{Text: string(runes[i+1 : end]), Quoted: true})
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune("()=!~\"'", runes[end]) {
+				end++
+			}
+			tokens = append(tokens, filterToken{Text: string(runes[i:end])})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+func (fp *filterParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("Invalid where expression '%s', %s", fp.expr, fmt.Sprintf(format, args...))
+}
+
+// peek returns the next token if it is an unquoted keyword or operator
+func (fp *filterParser) peek() string {
+	if fp.pos < len(fp.tokens) && !fp.tokens[fp.pos].Quoted {
+		return fp.tokens[fp.pos].Text
+	}
+	return ""
+}
+
+// expect consumes the next token, which must be the text
+func (fp *filterParser) expect(text string) error {
+	if fp.peek() != text {
+		if fp.pos >= len(fp.tokens) {
+			return fp.errorf("expected '%s' at the end", text)
+		}
+		return fp.errorf("expected '%s' not '%s'", text, fp.tokens[fp.pos].Text)
+	}
+	fp.pos++
+	return nil
+}
+
+func (fp *filterParser) parseExpr() (func(d *Document) bool, error) {
+	left, err := fp.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for fp.peek() == "or" {
+		fp.pos++
+		right, err := fp.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(d *Document) bool { return l(d) || right(d) }
+	}
+	return left, nil
+}
+
+func (fp *filterParser) parseTerm() (func(d *Document) bool, error) {
+	left, err := fp.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for fp.peek() == "and" {
+		fp.pos++
+		right, err := fp.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(d *Document) bool { return l(d) && right(d) }
+	}
+	return left, nil
+}
+
+func (fp *filterParser) parseFactor() (func(d *Document) bool, error) {
+	if fp.pos >= len(fp.tokens) {
+		return nil, fp.errorf("unexpected end")
+	}
+	word := fp.peek()
+	switch {
+	case word == "not":
+		fp.pos++
+		inner, err := fp.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return func(d *Document) bool { return !inner(d) }, nil
+
+	case word == "(":
+		fp.pos++
+		inner, err := fp.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return inner, fp.expect(")")
+
+	case containsAny([]string{word}, FilterRelations):
+		fp.pos++
+		if err := fp.expect("("); err != nil {
+			return nil, err
+		}
+		inner, err := fp.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := fp.expect(")"); err != nil {
+			return nil, err
+		}
+		return fp.p.relationFilter(word, inner), nil
+
+	case word == "" || strings.ContainsAny(word, "()=~") || word == "!=":
+		return nil, fp.errorf("unexpected '%s'", fp.tokens[fp.pos].Text)
+	}
+	return fp.parseComparison()
+}
+
+// parseComparison parses 'name op value'
+func (fp *filterParser) parseComparison() (func(d *Document) bool, error) {
+	name := fp.tokens[fp.pos].Text
+	fp.pos++
+	if !containsAny([]string{name}, FilterNames) && !fp.p.isFieldName(name) {
+		return nil, fp.errorf("unknown name '%s', expected one of: %s, or a template field", name, strings.Join(FilterNames, ", "))
+	}
+	op := fp.peek()
+	if op != "=" && op != "!=" && op != "~" {
+		return nil, fp.errorf("expected '=', '!=' or '~' after '%s'", name)
+	}
+	fp.pos++
+	if fp.pos >= len(fp.tokens) || (!fp.tokens[fp.pos].Quoted && strings.ContainsAny(fp.tokens[fp.pos].Text, "()=~!")) {
+		return nil, fp.errorf("missing value after '%s%s'", name, op)
+	}
+	value := fp.tokens[fp.pos].Text
+	fp.pos++
+	if name == "filename" && op != "~" {
+		value = withMdSuffix(value)
+	}
+
+	compare := func(v string) bool { return v == value }
+	if op == "~" {
+		lower := strings.ToLower(value)
+		compare = func(v string) bool { return strings.Contains(strings.ToLower(v), lower) }
+	}
+	// A document passes if any of its values compare, eg: any of its tags
+	anyValue := func(values []string) bool {
+		for _, v := range values {
+			if compare(v) {
+				return true
+			}
+		}
+		return false
+	}
+	var values func(d *Document) []string
+	switch name {
+	case "template":
+		values = func(d *Document) []string { return []string{d.Template.Shortcut} }
+	case "tag":
+		values = func(d *Document) []string { return d.TagNames() }
+	case "status":
+		values = func(d *Document) []string { return []string{d.Status} }
+	case "title":
+		values = func(d *Document) []string { return []string{d.Title} }
+	case "filename":
+		values = func(d *Document) []string { return []string{d.BaseFilename()} }
+	case "author":
+		values = func(d *Document) []string { return []string{d.Author} }
+	default:
+		values = func(d *Document) []string {
+			if v, ok := d.Fields[name]; ok {
+				return []string{v}
+			}
+			return []string{}
+		}
+	}
+	if op == "!=" {
+		return func(d *Document) bool { return !anyValue(values(d)) }, nil
+	}
+	return func(d *Document) bool { return anyValue(values(d)) }, nil
+}
+
+// isFieldName returns true if one of the templates declares the field
+func (p *Project) isFieldName(name string) bool {
+	for _, t := range p.Templates {
+		if t.FindField(name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// relationFilter returns a test for a document being related to one that
+// passes inner
+func (p *Project) relationFilter(relation string, inner func(d *Document) bool) func(d *Document) bool {
+	children := func(d *Document) []string { return d.ChildrenNames() }
+	parents := func(d *Document) []string { return p.ParentNames(d) }
+	switch relation {
+	case FilterLinksTo:
+		return func(d *Document) bool { return p.anyLinked(d, children, inner, false) }
+	case FilterLinkedFrom:
+		return func(d *Document) bool { return p.anyLinked(d, parents, inner, false) }
+	case FilterLinkedTo:
+		return func(d *Document) bool {
+			return p.anyLinked(d, children, inner, false) || p.anyLinked(d, parents, inner, false)
+		}
+	case FilterReaches:
+		return func(d *Document) bool { return p.anyLinked(d, children, inner, true) }
+	}
+	return func(d *Document) bool { return p.anyLinked(d, parents, inner, true) }
+}
+
+// anyLinked returns true if a document linked from d passes the test, following
+// the links transitively if requested
+func (p *Project) anyLinked(d *Document, links func(d *Document) []string, test func(d *Document) bool, transitive bool) bool {
+	seen := map[string]bool{d.BaseFilename(): true}
+	frontier := []*Document{d}
+	for len(frontier) > 0 {
+		next := []*Document{}
+		for _, f := range frontier {
+			for _, name := range links(f) {
+				if seen[name] {
+					continue
+				}
+				seen[name] = true
+				l := p.FindDocument(name)
+				if l == nil {
+					continue
+				}
+				if test(l) {
+					return true
+				}
+				next = append(next, l)
+			}
+		}
+		if !transitive {
+			return false
+		}
+		frontier = next
+	}
+	return false
+}
+
+// SelectDocuments returns the documents changed by a bulk command, and the rest
+// of its arguments. The documents match the where expression, or if there isnt
+// one the document named by the first argument
+func (p *Project) SelectDocuments(where string, args []string) ([]*Document, []string, error) {
+	if where != "" {
+		f, err := p.ParseFilter(where)
+		if err != nil {
+			return nil, args, err
+		}
+		return p.Filter(f), args, nil
+	}
+	document := withMdSuffix(args[0])
+	d := p.FindDocument(document)
+	if d == nil {
+		return nil, args[1:], fmt.Errorf("Cant find document '%s'", document)
+	}
+	return []*Document{d}, args[1:], nil
+}
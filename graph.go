@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	GraphDOT     = "dot"
+	GraphMermaid = "mermaid"
+	GraphML      = "graphml"
+)
+
+// GraphFormats are the output formats supported by 'mdd graph'
+var GraphFormats = []string{GraphDOT, GraphMermaid, GraphML}
+
+// Node fill colours, assigned to templates in shortcut order
+var graphPalette = []string{"#8dd3c7", "#ffffb3", "#bebada", "#fb8072", "#80b1d3", "#fdb462", "#b3de69", "#fccde5", "#d9d9d9", "#bc80bd"}
+
+// GraphFilter selects the documents included in a Graph. Empty filters include everything
+type GraphFilter struct {
+	Tags      []string
+	Templates []string
+	// Where expression the documents must match, or nil
+	Where *Filter
+
+	// Root limits the graph to the documents reachable from the root document,
+	// through at most Depth links. A Depth of 0 means no limit
+	Root  string
+	Depth int
+}
+
+type GraphEdge struct {
+	From     *Document
+	To       *Document
+	Relation string
+}
+
+// Graph is the parent/child network of documents
+type Graph struct {
+	Nodes []*Document
+	Edges []GraphEdge
+
+	// Map from template shortcut -> fill colour
+	Colours map[string]string
+}
+
+var mermaidIdRegex *regexp.Regexp
+
+func init() {
+	mermaidIdRegex = regexp.MustCompile("\\W")
+}
+
+// Graph builds the network of documents that pass the filter
+func (p *Project) Graph(f GraphFilter) (Graph, error) {
+	g := Graph{Colours: make(map[string]string)}
+	shortcuts := []string{}
+	for _, t := range p.Templates {
+		shortcuts = append(shortcuts, t.Shortcut)
+	}
+	sort.Strings(shortcuts)
+	for i, s := range shortcuts {
+		g.Colours[s] = graphPalette[i%len(graphPalette)]
+	}
+
+	// Limit to the documents within Depth links of the root
+	var within map[string]bool
+	if f.Root != "" {
+		root := p.FindDocument(f.Root)
+		if root == nil {
+			return g, fmt.Errorf("Cant find document '%s'", f.Root)
+		}
+		within = map[string]bool{root.BaseFilename(): true}
+		frontier := []*Document{root}
+		for depth := 1; len(frontier) > 0 && (f.Depth == 0 || depth <= f.Depth); depth++ {
+			next := []*Document{}
+			for _, d := range frontier {
+				for _, name := range d.ChildrenNames() {
+					c := p.FindDocument(name)
+					if c != nil && !within[name] {
+						within[name] = true
+						next = append(next, c)
+					}
+				}
+			}
+			frontier = next
+		}
+	}
+
+	included := make(map[string]*Document)
+	for _, d := range p.Documents {
+		if within != nil && !within[d.BaseFilename()] {
+			continue
+		}
+		if len(f.Tags) > 0 && !containsAny(d.TagNames(), f.Tags) {
+			continue
+		}
+		if len(f.Templates) > 0 && !containsAny([]string{d.Template.Shortcut}, f.Templates) {
+			continue
+		}
+		if f.Where != nil && !f.Where.Match(d) {
+			continue
+		}
+		included[d.BaseFilename()] = d
+		g.Nodes = append(g.Nodes, d)
+	}
+	for _, d := range g.Nodes {
+		for _, name := range d.ChildrenNames() {
+			if c, ok := included[name]; ok {
+				g.Edges = append(g.Edges, GraphEdge{From: d, To: c, Relation: d.Relation(name)})
+			}
+		}
+	}
+	return g, nil
+}
+
+// Write outputs the graph in one of the GraphFormats
+func (g *Graph) Write(out io.Writer, format string) error {
+	switch format {
+	case GraphDOT:
+		return g.WriteDOT(out)
+	case GraphMermaid:
+		return g.WriteMermaid(out)
+	case GraphML:
+		return g.WriteGraphML(out)
+	}
+	return checkFormat(format, GraphFormats)
+}
+
+// WriteDOT outputs the graph for Graphviz
+func (g *Graph) WriteDOT(out io.Writer) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "digraph mdd {\n")
+	fmt.Fprintf(&b, "  node [shape=box, style=filled];\n")
+	for _, d := range g.Nodes {
+		label := fmt.Sprintf("%s\\n%s", dotEscape(d.BaseFilename()), dotEscape(d.Title))
+		fmt.Fprintf(&b, "  \"%s\" [label=\"%s\", fillcolor=\"%s\"];\n", dotEscape(d.BaseFilename()), label, g.Colours[d.Template.Shortcut])
+	}
+	for _, e := range g.Edges {
+		if e.Relation != "" {
+			fmt.Fprintf(&b, "  \"%s\" -> \"%s\" [label=\"%s\"];\n", dotEscape(e.From.BaseFilename()), dotEscape(e.To.BaseFilename()), dotEscape(e.Relation))
+		} else {
+			fmt.Fprintf(&b, "  \"%s\" -> \"%s\";\n", dotEscape(e.From.BaseFilename()), dotEscape(e.To.BaseFilename()))
+		}
+	}
+	fmt.Fprintf(&b, "}\n")
+	_, err := out.Write(b.Bytes())
+	return err
+}
+
+func dotEscape(s string) string {
+	return strings.Replace(strings.Replace(s, "\\", "\\\\", -1), "\"", "\\\"", -1)
+}
+
+// WriteMermaid outputs the graph as a Mermaid flowchart
+func (g *Graph) WriteMermaid(out io.Writer) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "graph LR\n")
+	for _, d := range g.Nodes {
+		fmt.Fprintf(&b, "  %s[\"%s<br/>%s\"]\n", mermaidId(d), mermaidEscape(d.BaseFilename()), mermaidEscape(d.Title))
+	}
+	for _, e := range g.Edges {
+		if e.Relation != "" {
+			fmt.Fprintf(&b, "  %s -->|%s| %s\n", mermaidId(e.From), mermaidEscape(e.Relation), mermaidId(e.To))
+		} else {
+			fmt.Fprintf(&b, "  %s --> %s\n", mermaidId(e.From), mermaidId(e.To))
+		}
+	}
+
+	// One class per template, to colour the nodes
+	byTemplate := make(map[string][]string)
+	shortcuts := []string{}
+	for _, d := range g.Nodes {
+		s := d.Template.Shortcut
+		if byTemplate[s] == nil {
+			shortcuts = append(shortcuts, s)
+		}
+		byTemplate[s] = append(byTemplate[s], mermaidId(d))
+	}
+	sort.Strings(shortcuts)
+	for _, s := range shortcuts {
+		fmt.Fprintf(&b, "  classDef %s fill:%s\n", mermaidIdRegex.ReplaceAllString(s, "_"), g.Colours[s])
+		fmt.Fprintf(&b, "  class %s %s\n", strings.Join(byTemplate[s], ","), mermaidIdRegex.ReplaceAllString(s, "_"))
+	}
+	_, err := out.Write(b.Bytes())
+	return err
+}
+
+func mermaidId(d *Document) string {
+	return mermaidIdRegex.ReplaceAllString(strings.TrimSuffix(d.BaseFilename(), ".md"), "_")
+}
+
+func mermaidEscape(s string) string {
+	return strings.Replace(s, "\"", "#quot;", -1)
+}
+
+// WriteGraphML outputs the graph as GraphML, for tools such as yEd & Gephi
+func (g *Graph) WriteGraphML(out io.Writer) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s", xml.Header)
+	fmt.Fprintf(&b, "<graphml xmlns=\"http://graphml.graphdrawing.org/xmlns\">\n")
+	fmt.Fprintf(&b, "  <key id=\"label\" for=\"node\" attr.name=\"label\" attr.type=\"string\"/>\n")
+	fmt.Fprintf(&b, "  <key id=\"template\" for=\"node\" attr.name=\"template\" attr.type=\"string\"/>\n")
+	fmt.Fprintf(&b, "  <key id=\"color\" for=\"node\" attr.name=\"color\" attr.type=\"string\"/>\n")
+	fmt.Fprintf(&b, "  <key id=\"relation\" for=\"edge\" attr.name=\"relation\" attr.type=\"string\"/>\n")
+	fmt.Fprintf(&b, "  <graph id=\"mdd\" edgedefault=\"directed\">\n")
+	for _, d := range g.Nodes {
+		fmt.Fprintf(&b, "    <node id=\"%s\">\n", xmlEscape(d.BaseFilename()))
+		fmt.Fprintf(&b, "      <data key=\"label\">%s</data>\n", xmlEscape(d.Title))
+		fmt.Fprintf(&b, "      <data key=\"template\">%s</data>\n", xmlEscape(d.Template.Shortcut))
+		fmt.Fprintf(&b, "      <data key=\"color\">%s</data>\n", g.Colours[d.Template.Shortcut])
+		fmt.Fprintf(&b, "    </node>\n")
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "    <edge source=\"%s\" target=\"%s\">\n", xmlEscape(e.From.BaseFilename()), xmlEscape(e.To.BaseFilename()))
+		if e.Relation != "" {
+			fmt.Fprintf(&b, "      <data key=\"relation\">%s</data>\n", xmlEscape(e.Relation))
+		}
+		fmt.Fprintf(&b, "    </edge>\n")
+	}
+	fmt.Fprintf(&b, "  </graph>\n")
+	fmt.Fprintf(&b, "</graphml>\n")
+	_, err := out.Write(b.Bytes())
+	return err
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
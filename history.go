@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Commit is a git commit that changed a document
+type Commit struct {
+	Hash    string
+	Date    string
+	Author  string
+	Subject string
+	// Path of the document in the commit, relative to the top of the repository
+	Path string
+}
+
+// DocumentHistory is a commit and the changes it made to a document
+type DocumentHistory struct {
+	Commit  Commit
+	Changes []string
+}
+
+// DocumentDiff is the changes made to a document between two revisions
+type DocumentDiff struct {
+	Filename string
+	Changes  []string
+}
+
+// runGit runs git in dir, and returns its output
+func runGit(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return out, fmt.Errorf("git %s failed: %s", args[0], strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// gitDocumentPath returns the top of the git repository, and the document
+// directory relative to it
+func (p *Project) gitDocumentPath() (string, string, error) {
+	out, err := runGit(p.DocumentPath, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", "", err
+	}
+	top, err := filepath.EvalSymlinks(strings.TrimSpace(string(out)))
+	if err != nil {
+		return "", "", err
+	}
+	abs, err := filepath.Abs(p.DocumentPath)
+	if err != nil {
+		return "", "", err
+	}
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return "", "", err
+	}
+	rel, err := filepath.Rel(top, abs)
+	return top, filepath.ToSlash(rel), err
+}
+
+// showDocument returns the document at path in the revision, or nil if it
+// doesnt exist in that revision
+func (p *Project) showDocument(top, rev, path string) (*Document, error) {
+	raw, err := runGit(top, "show", fmt.Sprintf("%s:%s", rev, path))
+	if err != nil {
+		return nil, nil
+	}
+	return p.ParseDocument(path, raw)
+}
+
+// DocumentsAt returns the documents in the git revision, by filename, and the
+// reason each document that cant be read, eg: it doesnt parse with the current
+// templates, was rejected. An empty revision returns the documents in the
+// working directory
+func (p *Project) DocumentsAt(rev string) (map[string]*Document, map[string]error, error) {
+	docs := make(map[string]*Document)
+	unreadable := make(map[string]error)
+	if rev == "" {
+		for _, d := range p.Documents {
+			docs[d.BaseFilename()] = d
+		}
+		// The project leaves out the documents it cant read
+		files, err := ioutil.ReadDir(p.DocumentPath)
+		if err != nil {
+			return docs, unreadable, err
+		}
+		for _, f := range files {
+			if _, ok := docs[f.Name()]; ok || f.IsDir() || !filenameRegex.MatchString(f.Name()) {
+				continue
+			}
+			path := filepath.Join(p.DocumentPath, f.Name())
+			raw, err := ioutil.ReadFile(path)
+			if err == nil {
+				_, err = p.ParseDocument(path, raw)
+			}
+			if err != nil {
+				unreadable[f.Name()] = err
+			}
+		}
+		return docs, unreadable, nil
+	}
+
+	top, dir, err := p.gitDocumentPath()
+	if err != nil {
+		return docs, unreadable, err
+	}
+	out, err := runGit(top, "ls-tree", "-r", "--name-only", rev, "--", dir+"/")
+	if err != nil {
+		return docs, unreadable, err
+	}
+	for _, path := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if !filenameRegex.MatchString(filepath.Base(path)) {
+			continue
+		}
+		d, err := p.showDocument(top, rev, path)
+		if err != nil {
+			unreadable[filepath.Base(path)] = err
+			continue
+		}
+		if d != nil {
+			docs[d.BaseFilename()] = d
+		}
+	}
+	return docs, unreadable, nil
+}
+
+// Diff returns the changes to each document between the two revisions, in
+// filename order. An empty revision is the working directory
+func (p *Project) Diff(from, to string) ([]DocumentDiff, error) {
+	before, beforeErrs, err := p.DocumentsAt(from)
+	if err != nil {
+		return nil, err
+	}
+	after, afterErrs, err := p.DocumentsAt(to)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, m := range []map[string]*Document{before, after} {
+		for name := range m {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	for _, m := range []map[string]error{beforeErrs, afterErrs} {
+		for name := range m {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	diffs := []DocumentDiff{}
+	for _, name := range names {
+		// Versions that dont parse with the current templates are described
+		// rather than compared, like History
+		var changes []string
+		if err, ok := afterErrs[name]; ok {
+			changes = []string{fmt.Sprintf("cant compare, this version cant be read: %v", err)}
+		} else if err, ok := beforeErrs[name]; ok {
+			changes = []string{fmt.Sprintf("cant compare, the previous version cant be read: %v", err)}
+		} else {
+			changes = compareDocuments(before[name], after[name])
+		}
+		// Links broken by removing the document linked to
+		if d := after[name]; d != nil {
+			for _, child := range d.ChildrenNames() {
+				_, unreadable := afterErrs[child]
+				if _, ok := after[child]; !ok && !unreadable && before[child] != nil {
+					changes = append(changes, fmt.Sprintf("link broken -> %s, it was removed", child))
+				}
+			}
+		}
+		if len(changes) > 0 {
+			diffs = append(diffs, DocumentDiff{Filename: name, Changes: changes})
+		}
+	}
+	return diffs, nil
+}
+
+// History returns the commits that changed the document, newest first, and
+// the changes each made. Renames are followed
+func (p *Project) History(filename string) ([]DocumentHistory, error) {
+	top, dir, err := p.gitDocumentPath()
+	if err != nil {
+		return nil, err
+	}
+	out, err := runGit(top, "log", "--follow", "--date=short", "--format=%x00%h%x09%ad%x09%an%x09%s", "--name-only", "--", dir+"/"+filename)
+	if err != nil {
+		return nil, err
+	}
+
+	commits := []Commit{}
+	for _, record := range strings.Split(string(out), "\x00") {
+		lines := strings.Split(strings.TrimSpace(record), "\n")
+		fields := strings.SplitN(lines[0], "\t", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		c := Commit{Hash: fields[0], Date: fields[1], Author: fields[2], Subject: fields[3]}
+		c.Path = strings.TrimSpace(lines[len(lines)-1])
+		commits = append(commits, c)
+	}
+
+	history := []DocumentHistory{}
+	for i, c := range commits {
+		// Revisions that dont parse with the current templates, eg: before a
+		// template field was removed, are described rather than compared
+		after, afterErr := p.showDocument(top, c.Hash, c.Path)
+		// The document before the commit is the path in the previous commit
+		var before *Document
+		var beforeErr error
+		if i+1 < len(commits) {
+			before, beforeErr = p.showDocument(top, c.Hash+"^", commits[i+1].Path)
+		}
+		var changes []string
+		switch {
+		case afterErr != nil:
+			changes = []string{fmt.Sprintf("cant compare, this version cant be read: %v", afterErr)}
+		case beforeErr != nil:
+			changes = []string{fmt.Sprintf("cant compare, the previous version cant be read: %v", beforeErr)}
+		default:
+			changes = compareDocuments(before, after)
+		}
+		history = append(history, DocumentHistory{Commit: c, Changes: changes})
+	}
+	return history, nil
+}
+
+// compareDocuments describes the changes from before to after, either may be
+// nil if the document doesnt exist
+func compareDocuments(before, after *Document) []string {
+	changes := []string{}
+	switch {
+	case before == nil && after == nil:
+		return changes
+	case before == nil:
+		changes = append(changes, fmt.Sprintf("added '%s'", after.Title))
+		before = &Document{Children: map[string]string{}, Tags: map[string]bool{}}
+	case after == nil:
+		return append(changes, fmt.Sprintf("removed '%s'", before.Title))
+	default:
+		if before.BaseFilename() != after.BaseFilename() {
+			changes = append(changes, fmt.Sprintf("renamed from %s", before.BaseFilename()))
+		}
+		if before.Title != after.Title {
+			changes = append(changes, fmt.Sprintf("title '%s' -> '%s'", before.Title, after.Title))
+		}
+	}
+
+	if before.Status != after.Status && before.Status != "" {
+		changes = append(changes, fmt.Sprintf("status %s -> %s", before.Status, after.Status))
+	}
+	for _, tag := range after.TagNames() {
+		if !before.Tags[tag] {
+			changes = append(changes, fmt.Sprintf("tag added #%s", tag))
+		}
+	}
+	for _, tag := range before.TagNames() {
+		if !after.Tags[tag] {
+			changes = append(changes, fmt.Sprintf("tag removed #%s", tag))
+		}
+	}
+	for _, child := range after.ChildrenNames() {
+		relation, ok := before.Children[child]
+		if !ok {
+			changes = append(changes, "link created -> "+linkDescription(child, after.Relation(child)))
+		} else if relation != after.Relation(child) {
+			changes = append(changes, fmt.Sprintf("link changed -> %s, was %s", linkDescription(child, after.Relation(child)), linkDescription(child, relation)))
+		}
+	}
+	for _, child := range before.ChildrenNames() {
+		if _, ok := after.Children[child]; !ok {
+			changes = append(changes, "link removed -> "+linkDescription(child, before.Relation(child)))
+		}
+	}
+	for _, name := range after.FieldNames() {
+		if value, ok := before.Fields[name]; !ok {
+			changes = append(changes, fmt.Sprintf("%s set to %s", name, after.Fields[name]))
+		} else if value != after.Fields[name] {
+			changes = append(changes, fmt.Sprintf("%s %s -> %s", name, value, after.Fields[name]))
+		}
+	}
+	removed := []string{}
+	for name := range before.Fields {
+		if _, ok := after.Fields[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	for _, name := range removed {
+		changes = append(changes, fmt.Sprintf("%s removed", name))
+	}
+
+	if before.raw != nil {
+		added, removed := lineChanges(bodyLines(before), bodyLines(after))
+		if added > 0 || removed > 0 {
+			changes = append(changes, fmt.Sprintf("body changed, %d lines added, %d removed", added, removed))
+		}
+	}
+	return changes
+}
+
+func linkDescription(child, relation string) string {
+	if relation != "" {
+		return fmt.Sprintf("%s (%s)", child, relation)
+	}
+	return child
+}
+
+// bodyLines returns the non blank lines of the document body, without the
+// title which is compared separately
+func bodyLines(d *Document) []string {
+	lines := []string{}
+	title := false
+	for _, l := range strings.Split(d.Body(), LineBreak) {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+		if !title && titleRegex.MatchString(l) {
+			title = true
+			continue
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+// lineChanges counts the lines added & removed between before and after
+func lineChanges(before, after []string) (int, int) {
+	common := lcsTable(before, after)[0][0]
+	return len(after) - common, len(before) - common
+}
+
+// lcsTable returns the length of the longest common subsequence of lines of
+// before[i:] and after[j:], for every i & j
+func lcsTable(before, after []string) [][]int {
+	lcs := make([][]int, len(before)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] > lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	return lcs
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ImportFile is a markdown file being imported as a document
+type ImportFile struct {
+	// Path of the file being imported
+	Path string
+	// Filename of the new document
+	Filename string
+	Title    string
+	// Filenames of the imported documents it links to as children
+	Children []string
+	// Relative links that wont resolve once the file is moved, and why
+	Unresolved []string
+
+	body string
+	abs  string
+}
+
+// ImportError is a file that cant be imported, and the reason
+type ImportError struct {
+	Path string
+	Err  error
+}
+
+func (e ImportError) Error() string {
+	return fmt.Sprintf("Cant import '%s', %v", e.Path, e.Err)
+}
+
+// importLinkRegex matches the destination of an inline or reference style
+// markdown link, in group 2
+var importLinkRegex *regexp.Regexp
+
+func init() {
+	importLinkRegex = regexp.MustCompile("(?m)(\\]\\(\\s*<?|^\\s*\\[[^\\]]+\\]:\\s*<?)([^\\s()<>]+)")
+}
+
+// importPaths returns the markdown files in paths, directories are searched
+// for '.md' files, skipping any mdd project
+func importPaths(paths []string) ([]string, error) {
+	files := []string{}
+	seen := make(map[string]bool)
+	add := func(pth string) error {
+		abs, err := filepath.Abs(pth)
+		if err != nil {
+			return err
+		}
+		if !seen[abs] {
+			seen[abs] = true
+			files = append(files, pth)
+		}
+		return nil
+	}
+	for _, pth := range paths {
+		info, err := os.Stat(pth)
+		if err != nil {
+			return files, err
+		}
+		if !info.IsDir() {
+			if err := add(pth); err != nil {
+				return files, err
+			}
+			continue
+		}
+		dirFiles := []string{}
+		err = filepath.Walk(pth, func(walkPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && info.Name() == RootDirectory {
+				return filepath.SkipDir
+			}
+			if !info.IsDir() && filepath.Ext(walkPath) == ".md" {
+				dirFiles = append(dirFiles, walkPath)
+			}
+			return nil
+		})
+		if err != nil {
+			return files, err
+		}
+		sort.Strings(dirFiles)
+		for _, f := range dirFiles {
+			if err := add(f); err != nil {
+				return files, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// Import adds markdown files to the project as documents using the template.
+// Each file is given a filename, with the next free number, and a metadata
+// block, and is moved into the documents directory. If link is set, relative
+// links between the imported files are changed to the new filenames and added as
+// child links. Other relative links are changed to point at their file from the
+// documents directory, and those that cant be are listed in Unresolved. With
+// dryRun set nothing is changed. Files that cant be imported are returned as
+// ImportErrors
+func (p *Project) Import(paths []string, t *Template, link, dryRun bool) ([]*ImportFile, []ImportError, error) {
+	imports := []*ImportFile{}
+	rejects := []ImportError{}
+	files, err := importPaths(paths)
+	if err != nil {
+		return imports, rejects, err
+	}
+
+	// Check the files, before giving them numbers
+	for _, pth := range files {
+		raw, err := ioutil.ReadFile(pth)
+		if err != nil {
+			rejects = append(rejects, ImportError{Path: pth, Err: err})
+			continue
+		}
+		f := &ImportFile{Path: pth, body: string(raw)}
+		if f.abs, err = filepath.Abs(pth); err != nil {
+			return imports, rejects, err
+		}
+		for _, l := range strings.Split(f.body, LineBreak) {
+			if matches := titleRegex.FindStringSubmatch(l); len(matches) > 1 {
+				f.Title = matches[1]
+				break
+			}
+		}
+		switch {
+		case f.Title == "":
+			err = fmt.Errorf("it has no title, a heading like '# Title' using letters, digits, spaces and '-.~'")
+		case metaBlockRegex.MatchString(f.body):
+			err = fmt.Errorf("it already has a mdd metadata block")
+		default:
+			// Check ReadDocument will accept it
+			_, err = p.ParseDocument(p.documentFilename(t, 0), []byte(p.importContents(f, t)))
+		}
+		if err != nil {
+			rejects = append(rejects, ImportError{Path: pth, Err: err})
+			continue
+		}
+		imports = append(imports, f)
+	}
+
+	number := p.maxNumber()
+	byPath := make(map[string]*ImportFile)
+	for _, f := range imports {
+		number++
+		f.Filename = p.documentFilename(t, number)
+		byPath[f.abs] = f
+	}
+
+	documentPath, err := filepath.Abs(p.DocumentPath)
+	if err != nil {
+		return imports, rejects, err
+	}
+
+	// Point the relative links at the new locations
+	for _, f := range imports {
+		f.body = importLinkRegex.ReplaceAllStringFunc(f.body, func(match string) string {
+			m := importLinkRegex.FindStringSubmatch(match)
+			u, err := url.Parse(m[2])
+			if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || path.IsAbs(u.Path) {
+				return match
+			}
+			abs := filepath.Join(filepath.Dir(f.abs), filepath.FromSlash(u.Path))
+			destination := ""
+			if target, ok := byPath[abs]; ok {
+				if !link {
+					f.Unresolved = append(f.Unresolved, fmt.Sprintf("Link '%s' wont resolve, use -link to change links between imported files to child links", m[2]))
+					return match
+				}
+				if target != f && !containsAny([]string{target.Filename}, f.Children) {
+					f.Children = append(f.Children, target.Filename)
+				}
+				destination = target.Filename
+			} else if path.Ext(u.Path) == ".md" {
+				f.Unresolved = append(f.Unresolved, fmt.Sprintf("Link '%s' wont resolve, '%s' isnt being imported", m[2], u.Path))
+				return match
+			} else if !fileExists(abs) {
+				f.Unresolved = append(f.Unresolved, fmt.Sprintf("Link '%s' wont resolve, '%s' doesnt exist", m[2], u.Path))
+				return match
+			} else if rel, err := filepath.Rel(documentPath, abs); err == nil {
+				destination = filepath.ToSlash(rel)
+			} else {
+				f.Unresolved = append(f.Unresolved, fmt.Sprintf("Link '%s' wont resolve, %v", m[2], err))
+				return match
+			}
+			if u.Fragment != "" {
+				destination += "#" + u.Fragment
+			}
+			return m[1] + destination
+		})
+		sort.Strings(f.Children)
+	}
+
+	if dryRun {
+		return imports, rejects, nil
+	}
+	for _, f := range imports {
+		newPath := filepath.Join(p.DocumentPath, f.Filename)
+		if err := ioutil.WriteFile(newPath, []byte(p.importContents(f, t)), 0644); err != nil {
+			return imports, rejects, err
+		}
+		if err := os.Remove(f.Path); err != nil {
+			return imports, rejects, err
+		}
+	}
+	return imports, rejects, nil
+}
+
+// importContents returns the file with a metadata block for the new document
+func (p *Project) importContents(f *ImportFile, t *Template) string {
+	d := Document{
+		Template: t,
+		Status:   StatusDraft,
+		Author:   p.Author(),
+		DateTime: time.Now().Format(DateTimeFormat),
+		Children: make(map[string]string),
+		Tags:     make(map[string]bool),
+		Fields:   make(map[string]string),
+	}
+	for _, name := range f.Children {
+		d.Children[name] = ""
+	}
+	for _, field := range t.Fields {
+		if field.Default != "" {
+			d.Fields[field.Name] = field.Default
+		}
+	}
+	body := strings.TrimRight(f.body, LineBreak)
+	return fmt.Sprintf("%s\n\n%s\n", body, strings.Join(d.metadataForWrite(), LineBreak))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io"
+	"net/url"
+	"path"
+
+	"gopkg.in/russross/blackfriday.v2"
+)
+
+// InlineLink is a markdown link in the body of a document to another document,
+// eg: [see login](req-b7-0001.md#happy-path)
+type InlineLink struct {
+	// Filename of the document linked to
+	Filename string
+	// Fragment including the leading '#', or ""
+	Fragment string
+}
+
+// parseInlineLink returns the link if destination points at a markdown
+// document, relative to the document containing it
+func parseInlineLink(destination string) (InlineLink, bool) {
+	u, err := url.Parse(destination)
+	if err != nil || u.Scheme != "" || u.Host != "" || path.Ext(u.Path) != ".md" {
+		return InlineLink{}, false
+	}
+	link := InlineLink{Filename: path.Base(u.Path)}
+	if u.Fragment != "" {
+		link.Fragment = "#" + u.Fragment
+	}
+	return link, true
+}
+
+// InlineLinks returns the links to markdown documents in the body of the
+// document, in the order they first appear
+func (d *Document) InlineLinks() []InlineLink {
+	links := []InlineLink{}
+	seen := make(map[string]bool)
+	ast := blackfriday.New(blackfriday.WithExtensions(blackfriday.CommonExtensions)).Parse(d.raw)
+	ast.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if entering && node.Type == blackfriday.Link {
+			if link, ok := parseInlineLink(string(node.LinkData.Destination)); ok && !seen[link.Filename] {
+				seen[link.Filename] = true
+				links = append(links, link)
+			}
+		}
+		return blackfriday.GoToNext
+	})
+	return links
+}
+
+// linkRenderer renders HTML, pointing inline links to known documents at
+// their published HTML pages
+type linkRenderer struct {
+	*blackfriday.HTMLRenderer
+
+	// Map from filename -> DocView of every known document
+	docs map[string]DocView
+}
+
+func (r *linkRenderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	if entering && node.Type == blackfriday.Link {
+		if link, ok := parseInlineLink(string(node.LinkData.Destination)); ok {
+			if dv, known := r.docs[link.Filename]; known {
+				node.LinkData.Destination = []byte(dv.HtmlFilename + link.Fragment)
+			}
+		}
+	}
+	return r.HTMLRenderer.RenderNode(w, node, entering)
+}
+
+// CheckInlineLinks returns an error for each inline link to a document that
+// doesnt exist
+func (p *Project) CheckInlineLinks(d *Document) []error {
+	errs := []error{}
+	for _, link := range d.InlineLinks() {
+		if p.FindDocument(link.Filename) == nil {
+			errs = append(errs, newDocumentError(d.BaseFilename(), ErrCodeBrokenLink, "Document '%s' has inline link '%s' which doesnt exist", d.BaseFilename(), link.Filename))
+		}
+	}
+	return errs
+}
+
+// InlineLinkWarnings returns a warning for each inline link to a document that
+// isnt also a child. Prose links are common in older projects, so these dont
+// fail 'mdd verify'
+func (p *Project) InlineLinkWarnings(d *Document) []error {
+	warnings := []error{}
+	for _, link := range d.InlineLinks() {
+		if p.FindDocument(link.Filename) == nil {
+			continue
+		}
+		if _, ok := d.Children[link.Filename]; !ok && link.Filename != d.BaseFilename() {
+			warnings = append(warnings, newDocumentError(d.BaseFilename(), ErrCodeInlineLink, "Document '%s' has inline link '%s' which is not a child, run 'mdd verify -link-inline' to add it", d.BaseFilename(), link.Filename))
+		}
+	}
+	return warnings
+}
+
+// LinkInline adds the documents that d links to inline as children, and
+// returns their filenames
+func (p *Project) LinkInline(d *Document) ([]string, error) {
+	added := []string{}
+	for _, link := range d.InlineLinks() {
+		c := p.FindDocument(link.Filename)
+		if c == nil || d.HasChild(c) || c == d {
+			continue
+		}
+		if err := d.AddChild(c, ""); err != nil {
+			return added, err
+		}
+		added = append(added, link.Filename)
+	}
+	if len(added) > 0 {
+		p.parents = nil
+		p.Touch(d)
+		return added, d.WriteDocument()
+	}
+	return added, nil
+}
@@ -1,15 +1,17 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
-	"html/template"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 )
 
 const (
@@ -23,18 +25,36 @@ Usage:
 The commands are:
 
 	init        initialise a mdd repository
-	templates   list the templates available for use
+	templates   list and manage the templates available for use
 	new         add a new document based on a template
 	rm          remove a document
+	mv          rename a document, or move it to another template
+	renumber    renumber all the documents
+	import      import markdown files as documents
 	edit        edit a document
 	info        display project information
+	config      display or change the project configuration
 	ls          list documents created
+	search      search the documents
 	link        link a parent and child document
 	unlink      remove the link between a parent and child document
+	parents     list the documents that link to a document
 	tag         tag a document
 	untag       untag a document
+	status      display or change the status of a document
+	set         set a template field of a document
 	verify      verify the struture of the mdd repository documents
+	trace       display the requirements traceability matrix
+	graph       export the document links as a graph
+	history     display the changes made to a document in each git commit
+	diff        display the changes made to the documents between git revisions
 	publish     create a static website reflectings the mdd repository
+	export      combine every document into a single file
+	serve       serve the mdd repository as a website, with live preview
+	install-merge-driver
+	            configure git to merge documents with 'mdd merge-driver'
+	merge-driver
+	            merge a document, called by git
 `
 )
 
@@ -53,14 +73,30 @@ func main() {
 	newCommand := flag.NewFlagSet("new", flag.ExitOnError)
 	editCommand := flag.NewFlagSet("edit", flag.ExitOnError)
 	rmCommand := flag.NewFlagSet("rm", flag.ExitOnError)
+	mvCommand := flag.NewFlagSet("mv", flag.ExitOnError)
+	renumberCommand := flag.NewFlagSet("renumber", flag.ExitOnError)
+	importCommand := flag.NewFlagSet("import", flag.ExitOnError)
 	infoCommand := flag.NewFlagSet("info", flag.ExitOnError)
 	lsCommand := flag.NewFlagSet("ls", flag.ExitOnError)
+	searchCommand := flag.NewFlagSet("search", flag.ExitOnError)
 	linkCommand := flag.NewFlagSet("link", flag.ExitOnError)
 	unlinkCommand := flag.NewFlagSet("unlink", flag.ExitOnError)
+	parentsCommand := flag.NewFlagSet("parents", flag.ExitOnError)
 	tagCommand := flag.NewFlagSet("tag", flag.ExitOnError)
 	untagCommand := flag.NewFlagSet("untag", flag.ExitOnError)
+	statusCommand := flag.NewFlagSet("status", flag.ExitOnError)
+	setCommand := flag.NewFlagSet("set", flag.ExitOnError)
 	verifyCommand := flag.NewFlagSet("verify", flag.ExitOnError)
 	publishCommand := flag.NewFlagSet("publish", flag.ExitOnError)
+	exportCommand := flag.NewFlagSet("export", flag.ExitOnError)
+	traceCommand := flag.NewFlagSet("trace", flag.ExitOnError)
+	graphCommand := flag.NewFlagSet("graph", flag.ExitOnError)
+	serveCommand := flag.NewFlagSet("serve", flag.ExitOnError)
+	historyCommand := flag.NewFlagSet("history", flag.ExitOnError)
+	diffCommand := flag.NewFlagSet("diff", flag.ExitOnError)
+	mergeDriverCommand := flag.NewFlagSet("merge-driver", flag.ExitOnError)
+	installMergeDriverCommand := flag.NewFlagSet("install-merge-driver", flag.ExitOnError)
+	configCommand := flag.NewFlagSet("config", flag.ExitOnError)
 
 	// Init subcommand flag pointers
 	dir, err := os.Getwd()
@@ -78,10 +114,48 @@ func main() {
 
 	editPtr := newCommand.Bool("e", false, "Open the new file in your $EDITOR")
 
-	longPtr := lsCommand.Bool("l", false, "List in long format shows children, and tags")
+	tmplFormatPtr := tmplCommand.String("format", FormatText, fmt.Sprintf("Output format, one of: %s", strings.Join(OutputFormats, ", ")))
+	tmplForcePtr := tmplCommand.Bool("f", false, "With upgrade, replace templates that have local changes and no recorded base version")
+	infoFormatPtr := infoCommand.String("format", FormatText, fmt.Sprintf("Output format, one of: %s", strings.Join(OutputFormats, ", ")))
+	lsFormatPtr := lsCommand.String("format", FormatText, fmt.Sprintf("Output format, one of: %s", strings.Join(OutputFormats, ", ")))
+	verifyFormatPtr := verifyCommand.String("format", FormatText, fmt.Sprintf("Output format, one of: %s", strings.Join(OutputFormats, ", ")))
+	linkInlinePtr := verifyCommand.Bool("link-inline", false, "Add inline links to other documents as child links, before verifying")
+
+	longPtr := lsCommand.Bool("l", false, "List in long format shows children, parents, and tags")
 	onePtr := lsCommand.Bool("1", false, "Only display filenames, one per line")
+	lsStatusPtr := lsCommand.String("status", "", "Only list documents with this status")
+	lsWherePtr := lsCommand.String("where", "", "Only list documents matching the expression, see 'mdd help ls'")
+	searchWherePtr := searchCommand.String("where", "", "Only search documents matching the expression, see 'mdd help ls'")
+	tagWherePtr := tagCommand.String("where", "", "Tag the documents matching the expression instead of a single document, see 'mdd help ls'")
+	untagWherePtr := untagCommand.String("where", "", "Untag the documents matching the expression instead of a single document, see 'mdd help ls'")
+	statusWherePtr := statusCommand.String("where", "", "Display or change the status of the documents matching the expression, see 'mdd help ls'")
+
+	mvTemplatePtr := mvCommand.String("t", "", "Move the document to the template with this shortcut, keeping its number")
+	dryRunPtr := renumberCommand.Bool("n", false, "Only display the renames, dont make them")
+	importTemplatePtr := importCommand.String("template", "", "Shortcut of the template the imported documents use")
+	importLinkPtr := importCommand.Bool("link", false, "Add the relative links between the imported files as child links")
+	importDryRunPtr := importCommand.Bool("n", false, "Only display the files that would be imported, dont import them")
+
+	relationPtr := linkCommand.String("r", "", fmt.Sprintf("Relation type of the link, one of: %s", strings.Join(LinkRelations, ", ")))
 
 	publishPtr := publishCommand.String("o", dir, "Directory to publish the site to, defaults .mdd/publish")
+	fullPtr := publishCommand.Bool("f", false, "Delete the published files and rebuild them all")
+
+	exportFormatPtr := exportCommand.String("format", ExportMarkdown, fmt.Sprintf("Output format, one of: %s", strings.Join(ExportFormats, ", ")))
+	exportOutPtr := exportCommand.String("o", "", "File to write the export to, defaults to stdout for md & html")
+
+	addrPtr := serveCommand.String("addr", "localhost:8080", "Address to listen on")
+
+	traceFormatPtr := traceCommand.String("format", FormatText, fmt.Sprintf("Output format, one of: %s", strings.Join(TraceFormats, ", ")))
+	traceRowsPtr := traceCommand.String("rows", "", "Comma separated template shortcuts to use as rows, defaults to the publish.trace-rows config")
+	traceColsPtr := traceCommand.String("cols", "", "Comma separated template shortcuts to use as columns, defaults to the publish.trace-cols config")
+
+	graphFormatPtr := graphCommand.String("format", GraphDOT, fmt.Sprintf("Output format, one of: %s", strings.Join(GraphFormats, ", ")))
+	graphTagPtr := graphCommand.String("tag", "", "Comma separated tags, only include documents with one of them")
+	graphTemplatePtr := graphCommand.String("template", "", "Comma separated template shortcuts, only include documents using one of them")
+	graphRootPtr := graphCommand.String("root", "", "Only include documents linked from this document")
+	graphWherePtr := graphCommand.String("where", "", "Only include documents matching the expression, see 'mdd help ls'")
+	graphDepthPtr := graphCommand.Int("depth", 0, "Maximum number of links to follow from the root document, 0 for no limit")
 
 	// Verify that a subcommand has been provided
 	// os.Arg[0] is the main command
@@ -100,8 +174,13 @@ func main() {
 		initCommand.Parse(os.Args[2:])
 		err = doInit(initCommand, dirPtr, projectPtr, false)
 	case "templates":
-		tmplCommand.Parse(os.Args[2:])
-		err = doTemplates(tmplCommand, false)
+		if len(os.Args) >= 3 && !strings.HasPrefix(os.Args[2], "-") {
+			// Subcommand eg: 'mdd templates add'
+			tmplCommand.Parse(os.Args[3:])
+		} else {
+			tmplCommand.Parse(os.Args[2:])
+		}
+		err = doTemplates(tmplCommand, tmplFormatPtr, tmplForcePtr, false)
 	case "new":
 		if len(os.Args) >= 3 {
 			newCommand.Parse(os.Args[3:])
@@ -123,16 +202,44 @@ func main() {
 		} else {
 			err = fmt.Errorf("Cannot parse command line. Try 'mdd help rm'")
 		}
+	case "mv":
+		if len(os.Args) >= 3 {
+			mvCommand.Parse(os.Args[2:])
+			err = doMv(mvCommand, mvTemplatePtr, false)
+		} else {
+			err = fmt.Errorf("Cannot parse command line. Try 'mdd help mv'")
+		}
+	case "renumber":
+		renumberCommand.Parse(os.Args[2:])
+		err = doRenumber(renumberCommand, dryRunPtr, false)
+	case "import":
+		if len(os.Args) >= 3 {
+			importCommand.Parse(os.Args[2:])
+			err = doImport(importCommand, importTemplatePtr, importLinkPtr, importDryRunPtr, false)
+		} else {
+			err = fmt.Errorf("Cannot parse command line. Try 'mdd help import'")
+		}
 	case "info":
 		infoCommand.Parse(os.Args[2:])
-		err = doInfo(infoCommand, false)
+		err = doInfo(infoCommand, infoFormatPtr, false)
+	case "config":
+		if len(os.Args) >= 3 {
+			configCommand.Parse(os.Args[3:])
+			err = doConfig(configCommand, false)
+		} else {
+			err = fmt.Errorf("Cannot parse command line. Try 'mdd help config'")
+		}
+
 	case "ls":
 		lsCommand.Parse(os.Args[2:])
-		err = doLs(lsCommand, longPtr, onePtr, false)
+		err = doLs(lsCommand, longPtr, onePtr, lsFormatPtr, lsStatusPtr, lsWherePtr, false)
+	case "search":
+		searchCommand.Parse(os.Args[2:])
+		err = doSearch(searchCommand, searchWherePtr, false)
 	case "link":
 		if len(os.Args) >= 3 {
 			linkCommand.Parse(os.Args[2:])
-			err = doLink(linkCommand, false)
+			err = doLink(linkCommand, relationPtr, false)
 		} else {
 			err = fmt.Errorf("Cannot parse command line. Try 'mdd help link'")
 		}
@@ -143,27 +250,76 @@ func main() {
 		} else {
 			err = fmt.Errorf("Cannot parse command line. Try 'mdd help unlink'")
 		}
+	case "parents":
+		if len(os.Args) >= 3 {
+			parentsCommand.Parse(os.Args[2:])
+			err = doParents(parentsCommand, false)
+		} else {
+			err = fmt.Errorf("Cannot parse command line. Try 'mdd help parents'")
+		}
 	case "tag":
 		if len(os.Args) >= 3 {
 			tagCommand.Parse(os.Args[2:])
-			err = doTag(tagCommand, false)
+			err = doTag(tagCommand, tagWherePtr, false)
 		} else {
 			err = fmt.Errorf("Cannot parse command line. Try 'mdd help tag'")
 		}
 	case "untag":
 		if len(os.Args) >= 3 {
 			untagCommand.Parse(os.Args[2:])
-			err = doUntag(untagCommand, false)
+			err = doUntag(untagCommand, untagWherePtr, false)
 		} else {
 			err = fmt.Errorf("Cannot parse command line. Try 'mdd help untag'")
 		}
+	case "status":
+		if len(os.Args) >= 3 {
+			statusCommand.Parse(os.Args[2:])
+			err = doStatus(statusCommand, statusWherePtr, false)
+		} else {
+			err = fmt.Errorf("Cannot parse command line. Try 'mdd help status'")
+		}
+	case "set":
+		if len(os.Args) >= 3 {
+			setCommand.Parse(os.Args[2:])
+			err = doSet(setCommand, false)
+		} else {
+			err = fmt.Errorf("Cannot parse command line. Try 'mdd help set'")
+		}
 	case "verify":
 		verifyCommand.Parse(os.Args[2:])
-		err = doVerify(verifyCommand, false)
+		err = doVerify(verifyCommand, verifyFormatPtr, linkInlinePtr, false)
+
+	case "trace":
+		traceCommand.Parse(os.Args[2:])
+		err = doTrace(traceCommand, traceFormatPtr, traceRowsPtr, traceColsPtr, false)
+
+	case "graph":
+		graphCommand.Parse(os.Args[2:])
+		err = doGraph(graphCommand, graphFormatPtr, graphTagPtr, graphTemplatePtr, graphRootPtr, graphWherePtr, graphDepthPtr, false)
+
+	case "history":
+		if len(os.Args) >= 3 {
+			historyCommand.Parse(os.Args[2:])
+			err = doHistory(historyCommand, false)
+		} else {
+			err = fmt.Errorf("Cannot parse command line. Try 'mdd help history'")
+		}
+
+	case "diff":
+		if len(os.Args) >= 3 {
+			diffCommand.Parse(os.Args[2:])
+			err = doDiff(diffCommand, false)
+		} else {
+			err = fmt.Errorf("Cannot parse command line. Try 'mdd help diff'")
+		}
 
 	case "publish":
 		publishCommand.Parse(os.Args[2:])
-		err = doPublish(publishCommand, publishPtr, false)
+		err = doPublish(publishCommand, publishPtr, fullPtr, false)
+
+	case "export":
+		exportCommand.Parse(os.Args[2:])
+		err = doExport(exportCommand, exportFormatPtr, exportOutPtr, false)
 
 	case "help":
 		if len(os.Args) >= 3 {
@@ -171,29 +327,61 @@ func main() {
 			case "init":
 				doInit(initCommand, dirPtr, projectPtr, true)
 			case "templates":
-				doTemplates(tmplCommand, true)
+				doTemplates(tmplCommand, tmplFormatPtr, tmplForcePtr, true)
 			case "new":
 				doNew(newCommand, editPtr, true)
 			case "edit":
 				doEdit(editCommand, true)
 			case "rm":
 				doRm(rmCommand, true)
+			case "mv":
+				doMv(mvCommand, mvTemplatePtr, true)
+			case "renumber":
+				doRenumber(renumberCommand, dryRunPtr, true)
+			case "import":
+				doImport(importCommand, importTemplatePtr, importLinkPtr, importDryRunPtr, true)
 			case "info":
-				doInfo(infoCommand, true)
+				doInfo(infoCommand, infoFormatPtr, true)
+			case "config":
+				doConfig(configCommand, true)
 			case "ls":
-				doLs(lsCommand, longPtr, onePtr, true)
+				doLs(lsCommand, longPtr, onePtr, lsFormatPtr, lsStatusPtr, lsWherePtr, true)
+			case "search":
+				doSearch(searchCommand, searchWherePtr, true)
 			case "link":
-				doLink(linkCommand, true)
+				doLink(linkCommand, relationPtr, true)
 			case "unlink":
 				doUnlink(unlinkCommand, true)
+			case "parents":
+				doParents(parentsCommand, true)
 			case "tag":
-				doTag(tagCommand, true)
+				doTag(tagCommand, tagWherePtr, true)
 			case "untag":
-				doUntag(untagCommand, true)
+				doUntag(untagCommand, untagWherePtr, true)
+			case "status":
+				doStatus(statusCommand, statusWherePtr, true)
+			case "set":
+				doSet(setCommand, true)
 			case "verify":
-				doVerify(verifyCommand, true)
+				doVerify(verifyCommand, verifyFormatPtr, linkInlinePtr, true)
+			case "trace":
+				doTrace(traceCommand, traceFormatPtr, traceRowsPtr, traceColsPtr, true)
+			case "graph":
+				doGraph(graphCommand, graphFormatPtr, graphTagPtr, graphTemplatePtr, graphRootPtr, graphWherePtr, graphDepthPtr, true)
+			case "history":
+				doHistory(historyCommand, true)
+			case "diff":
+				doDiff(diffCommand, true)
 			case "publish":
-				doPublish(publishCommand, publishPtr, true)
+				doPublish(publishCommand, publishPtr, fullPtr, true)
+			case "export":
+				doExport(exportCommand, exportFormatPtr, exportOutPtr, true)
+			case "serve":
+				doServe(serveCommand, addrPtr, true)
+			case "merge-driver":
+				doMergeDriver(mergeDriverCommand, true)
+			case "install-merge-driver":
+				doInstallMergeDriver(installMergeDriverCommand, true)
 			default:
 				log.Printf("Unknown command '%s'", os.Args[2])
 				fmt.Println(helptext)
@@ -203,8 +391,18 @@ func main() {
 			fmt.Println(helptext)
 		}
 
-	// case "server":
-	// 	serverCommand.Parse(os.Args[2:])
+	case "serve":
+		serveCommand.Parse(os.Args[2:])
+		err = doServe(serveCommand, addrPtr, false)
+
+	case "merge-driver":
+		mergeDriverCommand.Parse(os.Args[2:])
+		err = doMergeDriver(mergeDriverCommand, false)
+
+	case "install-merge-driver":
+		installMergeDriverCommand.Parse(os.Args[2:])
+		err = doInstallMergeDriver(installMergeDriverCommand, false)
+
 	default:
 		log.Printf("Unknown command '%s'", os.Args[1])
 		fmt.Println(helptext)
@@ -213,7 +411,9 @@ func main() {
 
 	// Exit non zero on error
 	if err != nil {
-		log.Print(err)
+		if err != errSilentFailure {
+			log.Print(err)
+		}
 		os.Exit(1)
 	}
 
@@ -245,13 +445,63 @@ The arguments are:
 	return err
 }
 
-func doTemplates(flags *flag.FlagSet, displayHelp bool) error {
+func doTemplates(flags *flag.FlagSet, formatPtr *string, forcePtr *bool, displayHelp bool) error {
 	helptext := `
-mdd templates lists the templates available
+mdd templates lists and manages the templates available
 
 Usage:
 
-	mdd templates
+	mdd templates [arguments]
+	mdd templates add shortcut [title]
+	mdd templates rm shortcut
+	mdd templates show shortcut
+	mdd templates diff [shortcut...]
+	mdd templates upgrade [-f] [shortcut...]
+
+add creates a new template, with the shortcut used in document filenames, eg:
+'mdd templates add risk "Risk register"'. Edit it in .mdd/templates afterwards.
+rm removes a template, which no documents may use. show displays a template.
+
+mdd init copies the templates built into mdd into the project, and records the
+version copied. diff displays the changes made to the project's copy of the
+built-in templates. upgrade updates them to the templates built into this version
+of mdd, merging in any changes made to the project's copy. Conflicting changes are
+left between '<<<<<<<' and '>>>>>>>' lines to be fixed by hand. Projects created
+by older versions of mdd have no record of the version copied, so templates with
+local changes are skipped, unless -f is given to replace them. The html templates
+used by publish, eg: document.html, are named by their filename.
+
+Templates are the markdown files in .mdd/templates. A template may end with a
+template metadata block, which is not copied into new documents, eg:
+
+	<!-- mdd-template
+	mdd-transition: draft -> proposed
+	mdd-transition: proposed -> accepted
+	mdd-field: priority enum(low,medium,high) required default=medium
+	mdd-field: due date
+	mdd-section: required Context
+	mdd-section: optional Notes
+	-->
+
+Each 'mdd-transition' allows documents following the template to change from one
+status to another with 'mdd status'. Without any transitions, documents can
+change to any status.
+
+Each 'mdd-field' declares a custom metadata field, of the form:
+
+	name type [required] [default=value]
+
+The type is one of: string, int, date, enum(a,b,...) or doc-ref, the filename of
+another document. New documents start with the default values, fields are changed
+with 'mdd set', and 'mdd verify' checks every required field is set and every value
+is valid. Fields are stored in the document metadata as 'mdd-name: value'.
+
+Each 'mdd-section' declares a heading documents following the template should
+have, 'required' or 'optional', in the order they should appear. 'mdd verify'
+reports documents missing a required section, with an empty section, or with the
+sections out of order. Headings of any level match, ignoring case.
+
+The arguments are:
 `
 	// Asked for help
 	if displayHelp {
@@ -265,10 +515,28 @@ Usage:
 		return fmt.Errorf("Error parsing arguments")
 	}
 
+	if err := validFormat(*formatPtr); err != nil {
+		return err
+	}
+
 	p, err := FindProjectBelowCwd(true)
 	if err != nil {
 		return err
 	}
+
+	if len(os.Args) >= 3 && !strings.HasPrefix(os.Args[2], "-") {
+		return doTemplatesCommand(p, os.Args[2], flags.Args(), *forcePtr)
+	}
+	if *formatPtr != FormatText {
+		value := []TemplateRecord{}
+		records := []Record{}
+		for _, t := range p.Templates {
+			r := TemplateRecord{Shortcut: t.Shortcut, Title: t.Title}
+			value = append(value, r)
+			records = append(records, r)
+		}
+		return writeRecords(os.Stdout, *formatPtr, value, TemplateRecord{}.CSVHeader(), records)
+	}
 	if len(p.Templates) == 0 {
 		log.Printf("Project %s, has no templates", p.HomePath)
 	}
@@ -278,6 +546,93 @@ Usage:
 	return nil
 }
 
+// doTemplatesCommand runs one of the 'mdd templates' subcommands
+func doTemplatesCommand(p *Project, command string, args []string, force bool) error {
+	switch command {
+	case "add":
+		if len(args) < 1 {
+			return fmt.Errorf("Missing 'shortcut' argument")
+		}
+		title := strings.Join(args[1:], " ")
+		if title == "" {
+			title = args[0]
+		}
+		path, err := p.AddTemplate(args[0], title)
+		if err != nil {
+			return err
+		}
+		log.Printf("%s", path)
+	case "rm":
+		if len(args) != 1 {
+			return fmt.Errorf("Missing 'shortcut' argument")
+		}
+		return p.RemoveTemplate(args[0])
+	case "show":
+		if len(args) != 1 {
+			return fmt.Errorf("Missing 'shortcut' argument")
+		}
+		path := filepath.Join(p.TemplatePath, templateFilename(args[0]))
+		if !fileExists(path) {
+			return fmt.Errorf("No such template: '%s'", args[0])
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(b))
+	case "diff":
+		names, err := templateNames(args)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if !fileExists(filepath.Join(p.TemplatePath, name)) {
+				continue
+			}
+			lines, err := p.DiffTemplate(name)
+			if err != nil {
+				return err
+			}
+			for _, l := range lines {
+				log.Printf("%s", l)
+			}
+		}
+	case "upgrade":
+		names, err := templateNames(args)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			result, err := p.UpgradeTemplate(name, force)
+			if err != nil {
+				return err
+			}
+			log.Printf("%-15s %s", name, result)
+		}
+		return p.writeConfig()
+	default:
+		return fmt.Errorf("Unknown templates command '%s', expected one of: add, rm, show, diff, upgrade", command)
+	}
+	return nil
+}
+
+// templateNames returns the filenames of the built-in templates named by args,
+// or every built-in template if there are no args
+func templateNames(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return BuiltinTemplateNames()
+	}
+	names := []string{}
+	for _, a := range args {
+		name := templateFilename(a)
+		if !isBuiltinTemplate(name) {
+			return names, fmt.Errorf("Template '%s' isnt built into mdd", a)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
 func doNew(flags *flag.FlagSet, openEditor *bool, displayHelp bool) error {
 	helptext := `
 mdd new creates a new document from a template
@@ -324,7 +679,7 @@ The arguments are:
 			}
 			log.Printf("%s", doc.Filename)
 			if *openEditor {
-				return execEditor(doc.Filename)
+				return execEditor(p, doc.Filename)
 			}
 			return nil
 		}
@@ -340,7 +695,8 @@ Usage:
 
 	mdd edit document
 
-The $EDITOR environment variable specfies the editor command to run.
+The editor config, set with 'mdd config set editor', specifies the editor command to
+run, otherwise the $EDITOR environment variable.
 
 The arguments are:
 `
@@ -367,7 +723,7 @@ The arguments are:
 	}
 	for _, d := range p.Documents {
 		if d.BaseFilename() == filename {
-			return execEditor(d.Filename)
+			return execEditor(p, d.Filename)
 		}
 	}
 	return fmt.Errorf("No such file: '%s'", filename)
@@ -381,6 +737,9 @@ Usage:
 
 	mdd rm document...
 
+The doc-ref fields in other documents that refer to a deleted document are cleared,
+and listed.
+
 The arguments are:
 `
 	// Asked for help?
@@ -410,21 +769,35 @@ The arguments are:
 		if d == nil {
 			return fmt.Errorf("No such file: '%s'", file)
 		}
-		err = p.Delete(file)
+		cleared, err := p.Delete(file)
 		if err != nil {
 			return err
 		}
+		for _, line := range cleared {
+			log.Printf("%s", line)
+		}
 	}
 	return nil
 }
 
-func doInfo(flags *flag.FlagSet, displayHelp bool) error {
+func doMv(flags *flag.FlagSet, templatePtr *string, displayHelp bool) error {
 	helptext := `
-mdd info displays information about the project
+mdd mv renames a document, and updates every link to it
 
 Usage:
 
-	mdd info
+	mdd mv old new
+	mdd mv -t shortcut old
+
+old is the documents filename, new is its new filename. The child links, inline
+links and doc-ref fields in every document that refer to old are changed to refer
+to new.
+
+The template a document follows comes from its filename, so a new filename with a
+different shortcut moves the document to that template, eg: 'mdd mv nfr-b7-0003
+req-b7-0003'. The -t argument does the same, keeping the rest of the filename.
+Fields the new template doesnt declare, or whose values arent valid for it, are
+dropped, and listed.
 
 The arguments are:
 `
@@ -440,26 +813,66 @@ The arguments are:
 		return fmt.Errorf("Error parsing arguments")
 	}
 
+	// Missing document
+	args := flags.Args()
+	if (*templatePtr == "" && len(args) != 2) || (*templatePtr != "" && len(args) != 1) {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return fmt.Errorf("Missing arguments")
+	}
+
+	from := withMdSuffix(args[0])
+	to := ""
+	if *templatePtr != "" {
+		matches := filenameRegex.FindStringSubmatch(from)
+		if len(matches) != 4 {
+			return fmt.Errorf("Document '%s' doesnt match mdd filename regex", from)
+		}
+		to = fmt.Sprintf("%s-%s-%s.md", *templatePtr, matches[2], matches[3])
+	} else {
+		to = withMdSuffix(args[1])
+	}
+	if from == to {
+		return fmt.Errorf("Cant move to self")
+	}
+
 	p, err := FindProjectBelowCwd(true)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("mdd project info")
-	log.Printf("----------------")
-	log.Printf("path      : %s", p.HomePath)
-	log.Printf("templates : %d", len(p.Templates))
-	log.Printf("documents : %d", len(p.Documents))
+	dropped, err := p.Rename(map[string]string{from: to})
+	if err != nil {
+		return err
+	}
+	log.Printf("%s -> %s", from, to)
+	for _, line := range dropped {
+		log.Printf("%s", line)
+	}
 	return nil
 }
 
-func doLs(flags *flag.FlagSet, longPtr *bool, onePtr *bool, displayHelp bool) error {
+func doImport(flags *flag.FlagSet, templatePtr *string, linkPtr, dryRunPtr *bool, displayHelp bool) error {
 	helptext := `
-mdd ls lists all the documents created
+mdd import adds existing markdown files to the project as documents
 
 Usage:
 
-	mdd ls
+	mdd import path... -template shortcut [arguments]
+
+path is a markdown file, or a directory which is searched for '.md' files.
+shortcut is the template the documents use, eg: adr.
+
+Each file is given the next free document number, like 'mdd new', and a metadata
+block, and is moved into .mdd/documents. The title is the first heading, eg:
+'# Use Go for the backend'. -link changes the relative links between the imported
+files to the new filenames, and adds them as child links, without it they are left
+as they are. Other relative links, eg: to images, are changed to point at their
+file from .mdd/documents. Links that wont resolve after the import are reported.
+Files that cant be imported, eg: without a title, are reported and left where they
+are. eg:
+
+	mdd import -n docs/decisions -template adr -link
 
 The arguments are:
 `
@@ -475,46 +888,63 @@ The arguments are:
 		return fmt.Errorf("Error parsing arguments")
 	}
 
+	// Allow the arguments after the paths, eg: mdd import docs -template adr
+	paths := []string{}
+	for args := flags.Args(); len(args) > 0; args = flags.Args() {
+		paths = append(paths, args[0])
+		flags.Parse(args[1:])
+	}
+	if len(paths) == 0 {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return fmt.Errorf("Missing arguments")
+	}
+	if *templatePtr == "" {
+		return fmt.Errorf("Missing 'template' argument")
+	}
+
 	p, err := FindProjectBelowCwd(true)
 	if err != nil {
 		return err
 	}
-	for _, d := range p.Documents {
-		if *onePtr {
-			log.Printf("%s", d.BaseFilename())
-		} else {
-			tagStr := ""
-			for _, tag := range d.TagNames() {
-				tagStr = fmt.Sprintf("#%s %s", tag, tagStr)
-			}
-			log.Printf("%-15s       %-30s %s", d.BaseFilename(), d.Title, tagStr)
-		}
+	t := p.FindTemplate(*templatePtr)
+	if t == nil {
+		return fmt.Errorf("No such template: '%s'", *templatePtr)
+	}
 
-		// Display long listing?
-		if *longPtr {
-			for name := range d.Children {
-				d := p.FindDocument(name)
-				if d != nil {
-					log.Printf("  -> %-15s  %-30s", name, d.Title)
-				} else {
-					log.Printf("  -> %-15s", name)
-				}
-			}
+	imports, rejects, err := p.Import(paths, t, *linkPtr, *dryRunPtr)
+	if err != nil {
+		return err
+	}
+	for _, f := range imports {
+		log.Printf("%s -> %s", f.Path, f.Filename)
+		for _, name := range f.Children {
+			log.Printf("  -> %s", name)
 		}
+		for _, line := range f.Unresolved {
+			log.Printf("  %s", line)
+		}
+	}
+	for _, r := range rejects {
+		log.Printf("%v", r)
+	}
+	if len(rejects) > 0 {
+		return fmt.Errorf("Total %d files not imported", len(rejects))
 	}
 	return nil
 }
 
-func doLink(flags *flag.FlagSet, displayHelp bool) error {
+func doRenumber(flags *flag.FlagSet, dryRunPtr *bool, displayHelp bool) error {
 	helptext := `
-mdd link links a parent and child document
+mdd renumber gives every document a unique number, and updates every link
 
 Usage:
 
-	mdd link parent child
+	mdd renumber [arguments]
 
-parent is the parent documents filename.
-child is the child documents filename.
+Documents are numbered from 1, in the order of their current numbers, keeping their
+template shortcut. Useful after merging branches that created documents with the
+same number. The child links and inline links in every document are updated.
 
 The arguments are:
 `
@@ -525,72 +955,35 @@ The arguments are:
 		return nil
 	}
 
-	// log.Printf("%v %d", os.Args, len(os.Args))
 	// FlagSet.Parse() will evaluate to false if no flags were parsed
 	if !flags.Parsed() {
 		return fmt.Errorf("Error parsing arguments")
 	}
 
-	// Missing template shortcut
-	if len(os.Args[2:]) != 2 {
-		fmt.Println(helptext)
-		flags.PrintDefaults()
-		return fmt.Errorf("Missing arguments")
-	}
-
-	parent := os.Args[2:][0]
-	if !strings.HasSuffix(parent, ".md") {
-		parent = fmt.Sprintf("%s.md", parent)
-	}
-	child := os.Args[2:][1]
-	if !strings.HasSuffix(child, ".md") {
-		child = fmt.Sprintf("%s.md", child)
-	}
-	if parent == child {
-		return fmt.Errorf("Cant link to self")
-	}
-
 	p, err := FindProjectBelowCwd(true)
 	if err != nil {
 		return err
 	}
 
-	var pdoc *Document
-	var cdoc *Document
-	for _, d := range p.Documents {
-		if pdoc == nil && d.BaseFilename() == parent {
-			pdoc = d
-		}
-		if cdoc == nil && d.BaseFilename() == child {
-			cdoc = d
+	renames := p.Renumbering()
+	if !*dryRunPtr {
+		if _, err = p.Rename(renames); err != nil {
+			return err
 		}
 	}
-	if pdoc == nil {
-		return fmt.Errorf("Cant find parent '%s'", parent)
-	}
-	if cdoc == nil {
-		return fmt.Errorf("Cant find child '%s'", child)
-	}
-	if cdoc == pdoc {
-		return fmt.Errorf("Cant link to self")
-	}
-	if err = pdoc.AddChild(cdoc); err == nil {
-		err = pdoc.WriteDocument()
+	for _, line := range sortedRenames(renames) {
+		log.Printf("%s", line)
 	}
-	log.Printf("%s -> %s", pdoc.BaseFilename(), cdoc.BaseFilename())
-	return err
+	return nil
 }
 
-func doUnlink(flags *flag.FlagSet, displayHelp bool) error {
+func doInfo(flags *flag.FlagSet, formatPtr *string, displayHelp bool) error {
 	helptext := `
-mdd unlink breaks the link between a parent and child document
+mdd info displays information about the project
 
 Usage:
 
-	mdd unlink parent child
-
-parent is the parent documents filename.
-child is the child documents filename.
+	mdd info
 
 The arguments are:
 `
@@ -606,23 +999,8 @@ The arguments are:
 		return fmt.Errorf("Error parsing arguments")
 	}
 
-	// Missing document
-	if len(os.Args[2:]) != 2 {
-		fmt.Println(helptext)
-		flags.PrintDefaults()
-		return fmt.Errorf("Missing arguments")
-	}
-
-	parent := os.Args[2:][0]
-	if !strings.HasSuffix(parent, ".md") {
-		parent = fmt.Sprintf("%s.md", parent)
-	}
-	child := os.Args[2:][1]
-	if !strings.HasSuffix(child, ".md") {
-		child = fmt.Sprintf("%s.md", child)
-	}
-	if parent == child {
-		return fmt.Errorf("Cant unlink from self")
+	if err := validFormat(*formatPtr); err != nil {
+		return err
 	}
 
 	p, err := FindProjectBelowCwd(true)
@@ -630,37 +1008,39 @@ The arguments are:
 		return err
 	}
 
-	var pdoc *Document
-	var cdoc *Document
-	for _, d := range p.Documents {
-		if pdoc == nil && d.BaseFilename() == parent {
-			pdoc = d
-		}
-		if cdoc == nil && d.BaseFilename() == child {
-			cdoc = d
-		}
-	}
-	if pdoc == nil {
-		return fmt.Errorf("Cant find parent '%s'", parent)
-	}
-	if cdoc == nil {
-		return fmt.Errorf("Cant find child '%s'", child)
+	if *formatPtr != FormatText {
+		r := InfoRecord{Project: p.Config.Project, Path: p.HomePath, Templates: len(p.Templates), Documents: len(p.Documents)}
+		return writeRecords(os.Stdout, *formatPtr, r, r.CSVHeader(), []Record{r})
 	}
-	if err = pdoc.RemoveChild(child); err == nil {
-		err = pdoc.WriteDocument()
-	}
-	return err
+
+	log.Printf("mdd project info")
+	log.Printf("----------------")
+	log.Printf("project   : %s", p.Config.Project)
+	log.Printf("path      : %s", p.HomePath)
+	log.Printf("templates : %d", len(p.Templates))
+	log.Printf("documents : %d", len(p.Documents))
+	return nil
 }
 
-func doTag(flags *flag.FlagSet, displayHelp bool) error {
+func doConfig(flags *flag.FlagSet, displayHelp bool) error {
 	helptext := `
-mdd tag adds tags to a document
+mdd config displays or changes the project configuration
 
 Usage:
 
-	mdd tag document tag tag2 ...
+	mdd config list
+	mdd config get key
+	mdd config set key value...
 
-document is a documents filename.
+The configuration is stored in .mdd/config.yaml. The keys are:
+
+` + configKeysHelp() + `
+Keys that take a list, like verify.rules, are set to all the values given, eg:
+
+	mdd config set verify.rules "req links-to att itst" "adr linked-from mtg"
+
+Projects created by older versions of mdd store their settings in .mdd/project.data,
+which is migrated to .mdd/config.yaml the first time the project is read.
 
 The arguments are:
 `
@@ -676,51 +1056,943 @@ The arguments are:
 		return fmt.Errorf("Error parsing arguments")
 	}
 
-	// Missing document & tag
-	if len(os.Args[2:]) < 2 {
-		fmt.Println(helptext)
-		flags.PrintDefaults()
-		return fmt.Errorf("Missing arguments")
+	p, err := FindProjectBelowCwd(true)
+	if err != nil {
+		return err
 	}
 
-	document := os.Args[2:][0]
+	args := flags.Args()
+	switch os.Args[2] {
+	case "list":
+		for _, kv := range p.ListConfig() {
+			log.Printf("%s", strings.TrimSpace(fmt.Sprintf("%s: %s", kv[0], strings.Join(kv[1:], ", "))))
+		}
+	case "get":
+		if len(args) != 1 {
+			return fmt.Errorf("Missing 'key' argument")
+		}
+		values, err := p.GetConfig(args[0])
+		if err != nil {
+			return err
+		}
+		for _, v := range values {
+			log.Printf("%s", v)
+		}
+	case "set":
+		if len(args) == 0 {
+			return fmt.Errorf("Missing 'key' argument")
+		}
+		return p.SetConfig(args[0], args[1:])
+	default:
+		return fmt.Errorf("Unknown config command '%s', expected one of: list, get, set", os.Args[2])
+	}
+	return nil
+}
+
+func doLs(flags *flag.FlagSet, longPtr *bool, onePtr *bool, formatPtr *string, statusPtr *string, wherePtr *string, displayHelp bool) error {
+	helptext := `
+mdd ls lists all the documents created
+
+Usage:
+
+	mdd ls [arguments]
+
+The json, yaml and csv formats always include the children, tags and fields of each document.
+
+The -where argument selects documents with an expression, eg:
+
+	mdd ls -where 'template=req and tag=security and not linked-to(template=att)'
+
+The expression tests a document with 'name=value', 'name!=value', or 'name~text'
+which matches when the value contains the text, ignoring case. The names are:
+
+	template   template shortcut
+	tag        one of the tags
+	status     status eg: accepted
+	title      title
+	filename   filename, with or without the '.md' suffix
+	author     author who created the document
+	field      any field declared by a template, eg: priority=high
+
+The tests about the links between documents take an expression for the other document:
+
+	links-to(expr)       links to a child that matches
+	linked-from(expr)    is linked from a parent that matches
+	linked-to(expr)      links to, or is linked from, a document that matches
+	reaches(expr)        a document that matches can be reached by following child links
+	reached-from(expr)   can be reached by following child links from a document that matches
+
+Tests are combined with 'and', 'or', 'not' and brackets. Quote values containing
+spaces, eg: title~"user login". The -where argument is also accepted by search,
+tag, untag, status and graph.
+
+The arguments are:
+`
+	// Asked for help?
+	if displayHelp {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return nil
+	}
+
+	// FlagSet.Parse() will evaluate to false if no flags were parsed
+	if !flags.Parsed() {
+		return fmt.Errorf("Error parsing arguments")
+	}
+
+	if err := validFormat(*formatPtr); err != nil {
+		return err
+	}
+	if *statusPtr != "" && !validStatus(*statusPtr) {
+		return fmt.Errorf("Unknown status '%s', expected one of: %s", *statusPtr, strings.Join(Statuses, ", "))
+	}
+
+	p, err := FindProjectBelowCwd(true)
+	if err != nil {
+		return err
+	}
+	var where *Filter
+	if *wherePtr != "" {
+		if where, err = p.ParseFilter(*wherePtr); err != nil {
+			return err
+		}
+	}
+
+	// Filter by status & expression
+	docs := []*Document{}
+	for _, d := range p.Filter(where) {
+		if *statusPtr == "" || d.Status == *statusPtr {
+			docs = append(docs, d)
+		}
+	}
+
+	if *formatPtr != FormatText {
+		value := []DocumentRecord{}
+		records := []Record{}
+		for _, d := range docs {
+			r := d.ForRecord()
+			value = append(value, r)
+			records = append(records, r)
+		}
+		return writeRecords(os.Stdout, *formatPtr, value, DocumentRecord{}.CSVHeader(), records)
+	}
+	for _, d := range docs {
+		if *onePtr {
+			log.Printf("%s", d.BaseFilename())
+		} else {
+			tagStr := ""
+			for _, tag := range d.TagNames() {
+				tagStr = fmt.Sprintf("#%s %s", tag, tagStr)
+			}
+			log.Printf("%-15s       %-30s %-10s %s", d.BaseFilename(), d.Title, d.Status, tagStr)
+		}
+
+		// Display long listing?
+		if *longPtr {
+			for _, name := range d.ChildrenNames() {
+				relation := ""
+				if r := d.Relation(name); r != "" {
+					relation = fmt.Sprintf("(%s)", r)
+				}
+				c := p.FindDocument(name)
+				if c != nil {
+					log.Printf("  -> %-15s  %-30s %s", name, c.Title, relation)
+				} else {
+					log.Printf("  -> %-15s  %s", name, relation)
+				}
+			}
+			for _, name := range p.ParentNames(d) {
+				relation := ""
+				parent := p.FindDocument(name)
+				if r := parent.Relation(d.BaseFilename()); r != "" {
+					relation = fmt.Sprintf("(%s)", r)
+				}
+				log.Printf("  <- %-15s  %-30s %s", name, parent.Title, relation)
+			}
+			for _, name := range d.FieldNames() {
+				log.Printf("  %s: %s", name, d.Fields[name])
+			}
+			if created, modified := d.Created(), d.Modified(); modified != "" {
+				log.Printf("  %s, %s", created, modified)
+			} else if created != "" {
+				log.Printf("  %s", created)
+			}
+		}
+	}
+	return nil
+}
+
+func doSearch(flags *flag.FlagSet, wherePtr *string, displayHelp bool) error {
+	helptext := `
+mdd search searches the titles, tags and contents of the documents
+
+Usage:
+
+	mdd search query...
+
+The query is made up of words, "quoted phrases" and filters. A document matches if
+it contains every word and phrase, and passes every filter. The filters are:
+
+	tag:name         document has the tag
+	template:name    document uses the template eg: template:adr
+	status:name      document has the status eg: status:accepted
+
+Results are ranked by score, each match in the title scores 10, each matching tag
+scores 5 and each match in the document contents scores 1. eg:
+
+	mdd search '"user login" tag:security status:accepted'
+
+The -where argument only searches the documents matching an expression, see
+'mdd help ls'. With -where the query may be left out, eg:
+
+	mdd search -where 'template=req and not reaches(template=itst)'
+
+The arguments are:
+`
+	// Asked for help?
+	if displayHelp {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return nil
+	}
+
+	// FlagSet.Parse() will evaluate to false if no flags were parsed
+	if !flags.Parsed() {
+		return fmt.Errorf("Error parsing arguments")
+	}
+
+	// Missing query
+	if len(flags.Args()) == 0 && *wherePtr == "" {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return fmt.Errorf("Missing arguments")
+	}
+
+	q, err := ParseQuery(strings.Join(flags.Args(), " "))
+	if err != nil {
+		return err
+	}
+
+	p, err := FindProjectBelowCwd(true)
+	if err != nil {
+		return err
+	}
+	if *wherePtr != "" {
+		if q.Where, err = p.ParseFilter(*wherePtr); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range p.Search(q, terminalHighlight) {
+		log.Printf("%-15s       %-30s %d", r.Doc.BaseFilename(), r.Doc.Title, r.Score)
+		if r.Snippet != "" {
+			log.Printf("    %s", r.Snippet)
+		}
+	}
+	return nil
+}
+
+func doLink(flags *flag.FlagSet, relationPtr *string, displayHelp bool) error {
+	helptext := `
+mdd link links a parent and child document
+
+Usage:
+
+	mdd link [arguments] parent child
+
+parent is the parent documents filename.
+child is the child documents filename.
+
+Links are untyped by default, use -r to record the relationship between the
+documents eg: 'mdd link -r verifies att-b7-0002 req-b7-0001'.
+
+The arguments are:
+`
+	// Asked for help?
+	if displayHelp {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return nil
+	}
+
+	// log.Printf("%v %d", os.Args, len(os.Args))
+	// FlagSet.Parse() will evaluate to false if no flags were parsed
+	if !flags.Parsed() {
+		return fmt.Errorf("Error parsing arguments")
+	}
+
+	// Missing parent or child
+	if len(flags.Args()) != 2 {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return fmt.Errorf("Missing arguments")
+	}
+
+	parent := flags.Args()[0]
+	if !strings.HasSuffix(parent, ".md") {
+		parent = fmt.Sprintf("%s.md", parent)
+	}
+	child := flags.Args()[1]
+	if !strings.HasSuffix(child, ".md") {
+		child = fmt.Sprintf("%s.md", child)
+	}
+	if parent == child {
+		return fmt.Errorf("Cant link to self")
+	}
+
+	p, err := FindProjectBelowCwd(true)
+	if err != nil {
+		return err
+	}
+
+	var pdoc *Document
+	var cdoc *Document
+	for _, d := range p.Documents {
+		if pdoc == nil && d.BaseFilename() == parent {
+			pdoc = d
+		}
+		if cdoc == nil && d.BaseFilename() == child {
+			cdoc = d
+		}
+	}
+	if pdoc == nil {
+		return fmt.Errorf("Cant find parent '%s'", parent)
+	}
+	if cdoc == nil {
+		return fmt.Errorf("Cant find child '%s'", child)
+	}
+	if cdoc == pdoc {
+		return fmt.Errorf("Cant link to self")
+	}
+	if err = pdoc.AddChild(cdoc, *relationPtr); err != nil {
+		return err
+	}
+	p.Touch(pdoc)
+	if err = pdoc.WriteDocument(); err != nil {
+		return err
+	}
+	if *relationPtr != "" {
+		log.Printf("%s -> %s (%s)", pdoc.BaseFilename(), cdoc.BaseFilename(), *relationPtr)
+	} else {
+		log.Printf("%s -> %s", pdoc.BaseFilename(), cdoc.BaseFilename())
+	}
+	return nil
+}
+
+func doUnlink(flags *flag.FlagSet, displayHelp bool) error {
+	helptext := `
+mdd unlink breaks the link between a parent and child document
+
+Usage:
+
+	mdd unlink parent child
+
+parent is the parent documents filename.
+child is the child documents filename.
+
+The arguments are:
+`
+	// Asked for help?
+	if displayHelp {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return nil
+	}
+
+	// FlagSet.Parse() will evaluate to false if no flags were parsed
+	if !flags.Parsed() {
+		return fmt.Errorf("Error parsing arguments")
+	}
+
+	// Missing document
+	if len(os.Args[2:]) != 2 {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return fmt.Errorf("Missing arguments")
+	}
+
+	parent := os.Args[2:][0]
+	if !strings.HasSuffix(parent, ".md") {
+		parent = fmt.Sprintf("%s.md", parent)
+	}
+	child := os.Args[2:][1]
+	if !strings.HasSuffix(child, ".md") {
+		child = fmt.Sprintf("%s.md", child)
+	}
+	if parent == child {
+		return fmt.Errorf("Cant unlink from self")
+	}
+
+	p, err := FindProjectBelowCwd(true)
+	if err != nil {
+		return err
+	}
+
+	var pdoc *Document
+	var cdoc *Document
+	for _, d := range p.Documents {
+		if pdoc == nil && d.BaseFilename() == parent {
+			pdoc = d
+		}
+		if cdoc == nil && d.BaseFilename() == child {
+			cdoc = d
+		}
+	}
+	if pdoc == nil {
+		return fmt.Errorf("Cant find parent '%s'", parent)
+	}
+	if cdoc == nil {
+		return fmt.Errorf("Cant find child '%s'", child)
+	}
+	if err = pdoc.RemoveChild(child); err == nil {
+		p.Touch(pdoc)
+		err = pdoc.WriteDocument()
+	}
+	return err
+}
+
+func doParents(flags *flag.FlagSet, displayHelp bool) error {
+	helptext := `
+mdd parents lists the documents that link to a document
+
+Usage:
+
+	mdd parents document
+
+document is a documents filename. Each parent is listed with its title, and
+the relation of the link if it has one.
+
+The arguments are:
+`
+	// Asked for help?
+	if displayHelp {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return nil
+	}
+
+	// FlagSet.Parse() will evaluate to false if no flags were parsed
+	if !flags.Parsed() {
+		return fmt.Errorf("Error parsing arguments")
+	}
+
+	// Missing document
+	if len(flags.Args()) != 1 {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return fmt.Errorf("Missing arguments")
+	}
+
+	document := flags.Args()[0]
 	if !strings.HasSuffix(document, ".md") {
 		document = fmt.Sprintf("%s.md", document)
 	}
 
-	tags := os.Args[3:]
+	p, err := FindProjectBelowCwd(true)
+	if err != nil {
+		return err
+	}
+
+	doc := p.FindDocument(document)
+	if doc == nil {
+		return fmt.Errorf("Cant find document '%s'", document)
+	}
+	for _, name := range p.ParentNames(doc) {
+		parent := p.FindDocument(name)
+		relation := ""
+		if r := parent.Relation(doc.BaseFilename()); r != "" {
+			relation = fmt.Sprintf("(%s)", r)
+		}
+		log.Printf("%-15s       %-30s %s", name, parent.Title, relation)
+	}
+	return nil
+}
+
+func doTag(flags *flag.FlagSet, wherePtr *string, displayHelp bool) error {
+	helptext := `
+mdd tag adds tags to a document
+
+Usage:
+
+	mdd tag document tag tag2 ...
+	mdd tag -where expression tag tag2 ...
+
+document is a documents filename. With -where the tags are added to every
+document matching the expression, see 'mdd help ls', and the documents changed
+are displayed.
+
+The arguments are:
+`
+	// Asked for help?
+	if displayHelp {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return nil
+	}
+
+	// FlagSet.Parse() will evaluate to false if no flags were parsed
+	if !flags.Parsed() {
+		return fmt.Errorf("Error parsing arguments")
+	}
+
+	// Missing document & tag
+	if len(flags.Args()) < 2 && (*wherePtr == "" || len(flags.Args()) < 1) {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return fmt.Errorf("Missing arguments")
+	}
+
+	p, err := FindProjectBelowCwd(true)
+	if err != nil {
+		return err
+	}
+
+	docs, tags, err := p.SelectDocuments(*wherePtr, flags.Args())
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		// Only change the documents missing one of the tags
+		missing := false
+		for _, t := range tags {
+			missing = missing || !doc.Tags[t]
+		}
+		if *wherePtr != "" && !missing {
+			continue
+		}
+		for _, t := range tags {
+			if err = doc.Tag(t); err != nil {
+				return err
+			}
+		}
+		p.Touch(doc)
+		if err = doc.WriteDocument(); err != nil {
+			return err
+		}
+		if *wherePtr != "" {
+			log.Printf("%s", doc.BaseFilename())
+		}
+	}
+	return nil
+}
+
+func doUntag(flags *flag.FlagSet, wherePtr *string, displayHelp bool) error {
+	helptext := `
+mdd untag removes tags from a document
+
+Usage:
+
+	mdd untag document tag tag2 ...
+	mdd untag -where expression tag tag2 ...
+
+document is a documents filename. With -where the tags are removed from every
+document matching the expression, see 'mdd help ls', and the documents changed
+are displayed.
+
+The arguments are:
+`
+	// Asked for help?
+	if displayHelp {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return nil
+	}
+
+	// FlagSet.Parse() will evaluate to false if no flags were parsed
+	if !flags.Parsed() {
+		return fmt.Errorf("Error parsing arguments")
+	}
+
+	// Missing document
+	if len(flags.Args()) != 2 && (*wherePtr == "" || len(flags.Args()) < 1) {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return fmt.Errorf("Missing arguments")
+	}
+
+	p, err := FindProjectBelowCwd(true)
+	if err != nil {
+		return err
+	}
+
+	docs, tags, err := p.SelectDocuments(*wherePtr, flags.Args())
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		// Only change the documents that have one of the tags
+		if *wherePtr != "" && !containsAny(doc.TagNames(), tags) {
+			continue
+		}
+		for _, t := range tags {
+			if err = doc.Untag(t); err != nil {
+				return err
+			}
+		}
+		p.Touch(doc)
+		if err = doc.WriteDocument(); err != nil {
+			return err
+		}
+		if *wherePtr != "" {
+			log.Printf("%s", doc.BaseFilename())
+		}
+	}
+	return nil
+}
+
+func doStatus(flags *flag.FlagSet, wherePtr *string, displayHelp bool) error {
+	helptext := `
+mdd status displays or changes the status of a document
+
+Usage:
+
+	mdd status document [status]
+	mdd status -where expression [status]
+
+document is a documents filename.
+status is the new status, one of: draft, proposed, accepted, deprecated, superseded.
+With -where the status of every document matching the expression is displayed or
+changed, see 'mdd help ls'.
+
+Without a status, the current status of the document is displayed. Templates may
+restrict the changes allowed, see 'mdd help templates'.
+
+The arguments are:
+`
+	// Asked for help?
+	if displayHelp {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return nil
+	}
+
+	// FlagSet.Parse() will evaluate to false if no flags were parsed
+	if !flags.Parsed() {
+		return fmt.Errorf("Error parsing arguments")
+	}
+
+	// Missing document, or too many arguments
+	args := flags.Args()
+	if (*wherePtr == "" && len(args) < 1) || len(args) > 2 || (*wherePtr != "" && len(args) > 1) {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return fmt.Errorf("Missing arguments")
+	}
+
+	p, err := FindProjectBelowCwd(true)
+	if err != nil {
+		return err
+	}
+
+	docs, status, err := p.SelectDocuments(*wherePtr, args)
+	if err != nil {
+		return err
+	}
+	if len(status) == 0 {
+		for _, doc := range docs {
+			if *wherePtr != "" {
+				log.Printf("%-15s       %s", doc.BaseFilename(), doc.Status)
+			} else {
+				log.Printf("%s", doc.Status)
+			}
+		}
+		return nil
+	}
+
+	for _, doc := range docs {
+		if *wherePtr != "" && doc.Status == status[0] {
+			continue
+		}
+		from := doc.Status
+		if err = doc.SetStatus(status[0]); err != nil {
+			return err
+		}
+		p.Touch(doc)
+		if err = doc.WriteDocument(); err != nil {
+			return err
+		}
+		log.Printf("%s %s -> %s", doc.BaseFilename(), from, doc.Status)
+	}
+	return nil
+}
+
+func doSet(flags *flag.FlagSet, displayHelp bool) error {
+	helptext := `
+mdd set sets a template field of a document
+
+Usage:
+
+	mdd set document field value
+
+document is a documents filename.
+field is one of the fields declared by the document's template, see 'mdd help templates'.
+value is checked against the type of the field, eg: a date must be YYYY-MM-DD, and a
+doc-ref must be the filename of an existing document.
+
+The arguments are:
+`
+	// Asked for help?
+	if displayHelp {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return nil
+	}
+
+	// FlagSet.Parse() will evaluate to false if no flags were parsed
+	if !flags.Parsed() {
+		return fmt.Errorf("Error parsing arguments")
+	}
+
+	if len(flags.Args()) != 3 {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return fmt.Errorf("Missing arguments")
+	}
+
+	document := withMdSuffix(flags.Args()[0])
+	p, err := FindProjectBelowCwd(true)
+	if err != nil {
+		return err
+	}
+
+	doc := p.FindDocument(document)
+	if doc == nil {
+		return fmt.Errorf("Cant find document '%s'", document)
+	}
+	field := flags.Args()[1]
+	if err = p.SetField(doc, field, flags.Args()[2]); err != nil {
+		return err
+	}
+	p.Touch(doc)
+	if err = doc.WriteDocument(); err != nil {
+		return err
+	}
+	log.Printf("%s %s -> %s", doc.BaseFilename(), field, doc.Fields[field])
+	return nil
+}
+
+func doVerify(flags *flag.FlagSet, formatPtr *string, linkInlinePtr *bool, displayHelp bool) error {
+	helptext := `
+mdd verify checks the integrity of the documents
+
+Usage:
+
+	mdd verify [arguments]
+
+The return code will be zero if no errors exist, non-zero if one or more errors are detected.
+mdd verify is suitable for injecting into a CI pipeline to verify that documentation meets the
+basic level of structural checks.
+
+Coverage rules are read from the verify.rules config, set with 'mdd config set', and have one of
+the forms:
+
+	req links-to att itst
+	adr linked-from mtg
+
+The first requires every 'req' document to link to at least one 'att' or 'itst' document, the
+second requires every 'adr' document to be linked from at least one 'mtg' document.
+
+Inline markdown links in a document body to another document, eg: [see login](req-b7-0001.md),
+must point at a document that exists. A warning is displayed for inline links that arent also a
+child link, as the metadata and the body disagree, use -link-inline to add the missing child links.
+Warnings dont change the return code, and are only displayed in the text format.
+
+The arguments are:
+`
+	// Asked for help?
+	if displayHelp {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return nil
+	}
+
+	// FlagSet.Parse() will evaluate to false if no flags were parsed
+	if !flags.Parsed() {
+		return fmt.Errorf("Error parsing arguments")
+	}
+
+	if err := validFormat(*formatPtr); err != nil {
+		return err
+	}
+
+	errors := []ErrorRecord{}
+	warnings := []ErrorRecord{}
+	// Note: Open with errors returned
+	p, err := FindProjectBelowCwd(false)
+	if err != nil {
+		errors = append(errors, errorRecord(err))
+	}
+	// .. now open ignoring minor errors, so we can do more checking
+	p, err = FindProjectBelowCwd(true)
+	if err != nil {
+		errors = append(errors, errorRecord(err))
+	} else {
+		if *linkInlinePtr {
+			for _, d := range p.Documents {
+				added, err := p.LinkInline(d)
+				if err != nil {
+					return err
+				}
+				for _, name := range added {
+					if *formatPtr == FormatText {
+						log.Printf("%s -> %s", d.BaseFilename(), name)
+					}
+				}
+			}
+		}
+
+		for _, d := range p.Documents {
+			// Check each child pointer is valid
+			for _, name := range d.ChildrenNames() {
+				found := false
+				for _, c := range p.Documents {
+					if c.BaseFilename() == name {
+						found = true
+						break
+					}
+				}
+				if !found && d.Relation(name) != "" {
+					err = newDocumentError(d.BaseFilename(), ErrCodeMissingChild, "Document '%s' has child '%s' (%s) which doesnt exist", d.BaseFilename(), name, d.Relation(name))
+					errors = append(errors, errorRecord(err))
+				} else if !found {
+					err = newDocumentError(d.BaseFilename(), ErrCodeMissingChild, "Document '%s' has child '%s' which doesnt exist", d.BaseFilename(), name)
+					errors = append(errors, errorRecord(err))
+				}
+			}
+
+			// Check the inline links point at documents, and agree with the child links
+			for _, err := range p.CheckInlineLinks(d) {
+				errors = append(errors, errorRecord(err))
+			}
+			for _, err := range p.InlineLinkWarnings(d) {
+				warnings = append(warnings, errorRecord(err))
+			}
+
+			// Check the template fields
+			for _, err := range p.CheckFields(d) {
+				errors = append(errors, errorRecord(err))
+			}
+
+			// Check the template sections
+			for _, err := range p.CheckSections(d) {
+				errors = append(errors, errorRecord(err))
+			}
+		}
+
+		// Check the coverage rules
+		rules, err := p.VerifyRules()
+		if err != nil {
+			errors = append(errors, errorRecord(err))
+		}
+		for _, r := range rules {
+			for _, err := range r.Check(p) {
+				errors = append(errors, errorRecord(err))
+			}
+		}
+	}
+	// We can get duplicates because we open the project twice
+	errors = uniqueErrors(errors)
+
+	if *formatPtr != FormatText {
+		records := []Record{}
+		for _, e := range errors {
+			records = append(records, e)
+		}
+		if err := writeRecords(os.Stdout, *formatPtr, errors, ErrorRecord{}.CSVHeader(), records); err != nil {
+			return err
+		}
+		if len(errors) > 0 {
+			return errSilentFailure
+		}
+		return nil
+	}
+
+	for _, w := range warnings {
+		log.Printf("Warning: %s", w.Message)
+	}
+	if len(errors) > 0 {
+		for _, e := range errors {
+			log.Printf("%s", e.Message)
+		}
+		return fmt.Errorf("Total %d errors found", len(errors))
+	}
+	return nil
+}
+
+func uniqueErrors(s []ErrorRecord) []ErrorRecord {
+	unique := make(map[ErrorRecord]bool, len(s))
+	us := make([]ErrorRecord, 0, len(s))
+	for _, elem := range s {
+		if len(elem.Message) != 0 {
+			if !unique[elem] {
+				us = append(us, elem)
+				unique[elem] = true
+			}
+		}
+	}
+
+	return us
+
+}
+
+func doPublish(flags *flag.FlagSet, dirPtr *string, fullPtr *bool, displayHelp bool) error {
+	helptext := `
+mdd publish creates a static website for the mdd repository
+
+Usage:
+
+	mdd publish [arguments]
+
+Only documents that have changed, or whose linked documents titles have changed, since
+the last publish are converted. Pages for documents that no longer exist are removed.
+The hashes used to detect changes are kept in manifest.json in the publish directory.
+
+The arguments are:
+`
+	// Asked for help?
+	if displayHelp {
+		log.Println(helptext)
+		flags.PrintDefaults()
+		return nil
+	}
+
+	// FlagSet.Parse() will evaluate to false if no flags were parsed
+	if !flags.Parsed() {
+		return fmt.Errorf("Error parsing arguments")
+	}
 
 	p, err := FindProjectBelowCwd(true)
 	if err != nil {
 		return err
 	}
 
-	var doc *Document
-	for _, d := range p.Documents {
-		if doc == nil && d.BaseFilename() == document {
-			doc = d
-		}
-	}
-	if doc == nil {
-		return fmt.Errorf("Cant find document '%s'", document)
-	}
-	for _, t := range tags {
-		if err = doc.Tag(t); err != nil {
-			return err
-		}
+	stats, err := p.Publish(*fullPtr)
+	if err != nil {
+		return err
 	}
-	return doc.WriteDocument()
+	log.Printf("Published %d documents, %d unchanged, %d removed", stats.Converted, stats.Unchanged, stats.Removed)
+	return nil
 }
 
-func doUntag(flags *flag.FlagSet, displayHelp bool) error {
+func doExport(flags *flag.FlagSet, formatPtr, outPtr *string, displayHelp bool) error {
 	helptext := `
-mdd untag removes tags from a document
+mdd export combines every document into a single file
 
 Usage:
 
-	mdd untag document tag tag2 ...
+	mdd export [arguments]
 
-document is a documents filename.
+The documents are grouped by template, in the order set by the export.order
+config, followed by any other templates. The export starts with a table of
+contents, and ends with an appendix holding the traceability matrix, using the
+publish.trace-rows and publish.trace-cols config. Inline links between
+documents are changed to point within the export.
+
+The formats are:
+
+	md     a single markdown document
+	html   a single HTML page, rendered with the export.html template
+	epub   an EPUB book, which must be written to a file with -o
 
 The arguments are:
 `
@@ -736,53 +2008,60 @@ The arguments are:
 		return fmt.Errorf("Error parsing arguments")
 	}
 
-	// Missing document
-	if len(os.Args[2:]) != 2 {
-		fmt.Println(helptext)
-		flags.PrintDefaults()
-		return fmt.Errorf("Missing arguments")
+	if err := checkFormat(*formatPtr, ExportFormats); err != nil {
+		return err
 	}
-
-	document := os.Args[2:][0]
-	if !strings.HasSuffix(document, ".md") {
-		document = fmt.Sprintf("%s.md", document)
+	if *formatPtr == ExportEPUB && *outPtr == "" {
+		return fmt.Errorf("Missing 'o' argument, the epub format must be written to a file")
 	}
 
-	tags := os.Args[3:]
-
 	p, err := FindProjectBelowCwd(true)
 	if err != nil {
 		return err
 	}
 
-	var doc *Document
-	for _, d := range p.Documents {
-		if doc == nil && d.BaseFilename() == document {
-			doc = d
+	var b bytes.Buffer
+	switch *formatPtr {
+	case ExportMarkdown:
+		b.Write(p.ExportMarkdown())
+	case ExportHTML:
+		html, err := p.ExportHTML()
+		if err != nil {
+			return err
 		}
-	}
-	if doc == nil {
-		return fmt.Errorf("Cant find document '%s'", document)
-	}
-	for _, t := range tags {
-		if err = doc.Untag(t); err != nil {
+		b.Write(html)
+	case ExportEPUB:
+		if err := p.WriteEPUB(&b); err != nil {
 			return err
 		}
 	}
-	return doc.WriteDocument()
+
+	if *outPtr == "" {
+		_, err = os.Stdout.Write(b.Bytes())
+		return err
+	}
+	if err := ioutil.WriteFile(*outPtr, b.Bytes(), 0644); err != nil {
+		return err
+	}
+	log.Printf("Exported %d documents to %s", len(p.Documents), *outPtr)
+	return nil
 }
 
-func doVerify(flags *flag.FlagSet, displayHelp bool) error {
+func doTrace(flags *flag.FlagSet, formatPtr, rowsPtr, colsPtr *string, displayHelp bool) error {
 	helptext := `
-mdd verify checks the integrity of the documents
+mdd trace displays the requirements traceability matrix
 
 Usage:
 
-	mdd verify
+	mdd trace [arguments]
 
-The return code will be zero if no errors exist, non-zero if one or more errors are detected.
-mdd verify is suitable for injecting into a CI pipeline to verify that documentation meets the
-basic level of structural checks.
+Requirement documents are listed as rows and test documents as columns. A
+mark is shown wherever the documents are linked, directly or transitively
+through other documents, in either direction. The percentage of requirements
+linked to at least one test is shown as the coverage.
+
+The html format writes trace.html into the publish directory alongside the
+output of 'mdd publish'.
 
 The arguments are:
 `
@@ -798,74 +2077,60 @@ The arguments are:
 		return fmt.Errorf("Error parsing arguments")
 	}
 
-	errors := []string{}
-	// Note: Open with errors returned
-	p, err := FindProjectBelowCwd(false)
-	if err != nil {
-		errors = append(errors, err.Error())
+	if err := checkFormat(*formatPtr, TraceFormats); err != nil {
+		return err
 	}
-	// .. now open ignoring minor errors, so we can do more checking
-	p, err = FindProjectBelowCwd(true)
+
+	p, err := FindProjectBelowCwd(true)
 	if err != nil {
-		errors = append(errors, err.Error())
-	} else {
-		for _, d := range p.Documents {
-			// Check each child pointer is valid
-			for name := range d.Children {
-				found := false
-				for _, c := range p.Documents {
-					if c.BaseFilename() == name {
-						found = true
-						break
-					}
-				}
-				if !found {
-					err = fmt.Errorf("Document '%s' has child '%s' which doesnt exist\n", d.BaseFilename(), name)
-					errors = append(errors, err.Error())
-				}
-			}
-		}
+		return err
 	}
-	// We can get duplicates because we open the project twice
-	errors = uniqueElements(errors)
 
-	if len(errors) > 0 {
-		for _, e := range errors {
-			log.Printf(e)
+	rows, cols := p.Config.Publish.TraceRows, p.Config.Publish.TraceCols
+	if *rowsPtr != "" {
+		rows = strings.Split(*rowsPtr, ",")
+	}
+	if *colsPtr != "" {
+		cols = strings.Split(*colsPtr, ",")
+	}
+	m := p.TraceMatrix(rows, cols)
+	switch *formatPtr {
+	case FormatText:
+		m.PrintText()
+	case FormatCSV:
+		return m.WriteCSV(os.Stdout)
+	case TraceHTML:
+		outFile, err := p.WriteTraceHTML(&m, p.PublishPath)
+		if err != nil {
+			return err
 		}
-		return fmt.Errorf("Total %d errors found", len(errors))
+		log.Printf("%s", outFile)
+		log.Printf("%s", m.CoverageSummary())
 	}
 	return nil
 }
 
-func uniqueElements(s []string) []string {
-	unique := make(map[string]bool, len(s))
-	us := make([]string, len(unique))
-	for _, elem := range s {
-		if len(elem) != 0 {
-			if !unique[elem] {
-				us = append(us, elem)
-				unique[elem] = true
-			}
-		}
-	}
-
-	return us
-
-}
-func doPublish(flags *flag.FlagSet, dirPtr *string, displayHelp bool) error {
+func doGraph(flags *flag.FlagSet, formatPtr, tagPtr, templatePtr, rootPtr, wherePtr *string, depthPtr *int, displayHelp bool) error {
 	helptext := `
-mdd publish creates a static website for the mdd repository
+mdd graph exports the links between documents as a graph
 
 Usage:
 
-	mdd publish [arguments]
+	mdd graph [arguments]
+
+Each document is a node labelled with its filename and title, and coloured by
+its template. Each link from a parent to a child is an edge, labelled with its
+relation if it has one. The graph is written to stdout in one of these formats:
+
+	dot       Graphviz, eg: mdd graph | dot -Tsvg > graph.svg
+	mermaid   Mermaid flowchart, for embedding in markdown
+	graphml   GraphML, for tools such as yEd or Gephi
 
 The arguments are:
 `
 	// Asked for help?
 	if displayHelp {
-		log.Println(helptext)
+		fmt.Println(helptext)
 		flags.PrintDefaults()
 		return nil
 	}
@@ -880,91 +2145,184 @@ The arguments are:
 		return err
 	}
 
-	err = p.DeleteAllPublished()
+	filter := GraphFilter{Root: *rootPtr, Depth: *depthPtr}
+	if filter.Root != "" && !strings.HasSuffix(filter.Root, ".md") {
+		filter.Root = fmt.Sprintf("%s.md", filter.Root)
+	}
+	if *tagPtr != "" {
+		filter.Tags = strings.Split(*tagPtr, ",")
+	}
+	if *templatePtr != "" {
+		filter.Templates = strings.Split(*templatePtr, ",")
+	}
+	if *wherePtr != "" {
+		if filter.Where, err = p.ParseFilter(*wherePtr); err != nil {
+			return err
+		}
+	}
+	g, err := p.Graph(filter)
 	if err != nil {
 		return err
 	}
+	return g.Write(os.Stdout, *formatPtr)
+}
+
+func doHistory(flags *flag.FlagSet, displayHelp bool) error {
+	helptext := `
+mdd history displays the changes made to a document in each git commit
 
-	// Build up a data structure to use when we spit out the
-	// index.html file
-	data := struct {
-		// Map from tags -> DocView with that tag
-		TagDocs map[string][]DocView
+Usage:
 
-		// Map from Template filename to Documents following that template
-		TmplDocs map[string][]DocView
+	mdd history document
 
-		// Map from Template filename to Template title
-		TmplTitles map[string]string
+document is a documents filename. The commits that changed the document are listed
+newest first, following renames, each with the changes it made eg: title changes,
+tags added or removed, links created or removed, and body changes. Versions that
+cant be read with the current templates, eg: after a template field was removed,
+are listed without comparing them.
 
-		// Map from filename -> DocView
-		FilenameDocs map[string]DocView
-	}{
-		TagDocs:      make(map[string][]DocView),
-		TmplDocs:     make(map[string][]DocView),
-		TmplTitles:   make(map[string]string),
-		FilenameDocs: make(map[string]DocView),
+The arguments are:
+`
+	// Asked for help?
+	if displayHelp {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return nil
 	}
 
-	for _, d := range p.Documents {
+	// FlagSet.Parse() will evaluate to false if no flags were parsed
+	if !flags.Parsed() {
+		return fmt.Errorf("Error parsing arguments")
+	}
 
-		dv := d.ForView()
+	// Missing document
+	if len(flags.Args()) != 1 {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return fmt.Errorf("Missing arguments")
+	}
+	document := withMdSuffix(flags.Args()[0])
 
-		// Map by filename
-		data.FilenameDocs[dv.BaseFilename] = dv
+	p, err := FindProjectBelowCwd(true)
+	if err != nil {
+		return err
+	}
 
-		// Index by Tag
-		for _, t := range d.TagNames() {
-			if data.TagDocs[t] == nil {
-				data.TagDocs[t] = make([]DocView, 0)
-			}
-			data.TagDocs[t] = append(data.TagDocs[t], dv)
+	history, err := p.History(document)
+	if err != nil {
+		return err
+	}
+	if len(history) == 0 {
+		return fmt.Errorf("No history found for document '%s'", document)
+	}
+	for _, h := range history {
+		log.Printf("%s %s %s  %s", h.Commit.Hash, h.Commit.Date, h.Commit.Author, h.Commit.Subject)
+		for _, c := range h.Changes {
+			log.Printf("  %s", c)
 		}
+	}
+	return nil
+}
 
-		// Index by Template
-		if data.TmplDocs[dv.TemplateFilename] == nil {
-			data.TmplDocs[dv.TemplateFilename] = make([]DocView, 0)
-			data.TmplTitles[dv.TemplateFilename] = dv.TemplateTitle
-		}
-		data.TmplDocs[dv.TemplateFilename] = append(data.TmplDocs[dv.TemplateFilename], d.ForView())
+func doDiff(flags *flag.FlagSet, displayHelp bool) error {
+	helptext := `
+mdd diff displays the changes made to the documents between two git revisions
 
-		// log.Printf("Converting %s\n", d.Filename)
-		err = d.ConvertToHTML(p.PublishPath)
-		if err != nil {
-			return err
-		}
+Usage:
 
+	mdd diff rev1 [rev2]
+
+rev1 and rev2 are git revisions eg: a commit, branch or tag. If rev2 is not given
+the documents in the working directory are used. Each changed document is listed
+with its changes eg: added or removed, title changes, tags added or removed, links
+created, removed or broken, and body changes. Versions that cant be read with the
+current templates are listed without comparing them.
+
+The arguments are:
+`
+	// Asked for help?
+	if displayHelp {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return nil
 	}
 
-	// Create the index.html document
-	tmpl, err := template.ParseFiles(filepath.Join(p.TemplatePath, "index.html"))
-	if err != nil {
-		return err
+	// FlagSet.Parse() will evaluate to false if no flags were parsed
+	if !flags.Parsed() {
+		return fmt.Errorf("Error parsing arguments")
 	}
 
-	outFile := filepath.Join(p.PublishPath, "index.html")
-	_, err = os.Stat(outFile)
-	if !os.IsNotExist(err) {
-		return fmt.Errorf("index file '%s' already exists", outFile)
+	// Missing revisions
+	if len(flags.Args()) < 1 || len(flags.Args()) > 2 {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return fmt.Errorf("Missing arguments")
+	}
+	from := flags.Args()[0]
+	to := ""
+	if len(flags.Args()) == 2 {
+		to = flags.Args()[1]
 	}
-	file, err := os.OpenFile(outFile, os.O_CREATE|os.O_RDWR, 0644)
+
+	p, err := FindProjectBelowCwd(true)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	err = tmpl.Execute(file, data)
+
+	diffs, err := p.Diff(from, to)
 	if err != nil {
 		return err
 	}
-	// log.Printf("%s\n", outFile)
+	for _, d := range diffs {
+		log.Printf("%s", d.Filename)
+		for _, c := range d.Changes {
+			log.Printf("  %s", c)
+		}
+	}
 	return nil
 }
 
-func execEditor(filename string) error {
-	val := ""
-	val, ok := os.LookupEnv("EDITOR")
-	if !ok {
-		return fmt.Errorf("Envar EDITOR not set")
+func doServe(flags *flag.FlagSet, addrPtr *string, displayHelp bool) error {
+	helptext := `
+mdd serve runs a local web server that renders the documents on demand
+
+Usage:
+
+	mdd serve [arguments]
+
+Pages are rendered from the current contents of the documents on every request,
+and the browser reloads automatically whenever a file in .mdd/documents changes.
+
+The arguments are:
+`
+	// Asked for help?
+	if displayHelp {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return nil
+	}
+
+	// FlagSet.Parse() will evaluate to false if no flags were parsed
+	if !flags.Parsed() {
+		return fmt.Errorf("Error parsing arguments")
+	}
+
+	p, err := FindProjectBelowCwd(true)
+	if err != nil {
+		return err
+	}
+
+	return NewServer(p, time.Second).ListenAndServe(*addrPtr)
+}
+
+func execEditor(p *Project, filename string) error {
+	val := p.Config.Editor
+	if val == "" {
+		var ok bool
+		val, ok = os.LookupEnv("EDITOR")
+		if !ok {
+			return fmt.Errorf("Envar EDITOR not set, and no editor config")
+		}
 	}
 
 	// EDITOR miight be set to a value like '/path/to/editor --some-flags', so we
@@ -982,3 +2340,93 @@ func execEditor(filename string) error {
 	err = syscall.Exec(binary, args, os.Environ())
 	return err
 }
+
+func doMergeDriver(flags *flag.FlagSet, displayHelp bool) error {
+	helptext := `
+mdd merge-driver merges a document, it is called by git when merging branches
+
+Usage:
+
+	mdd merge-driver base ours theirs
+
+base, ours and theirs are the common ancestor, current and other versions of the
+document. The merged document is written to ours.
+
+The children and tags in the metadata block are merged as sets, so links and tags
+added or removed on either branch are kept. Other metadata, such as the status,
+conflicts only if both branches changed it. The rest of the document is merged as
+text. The exit code is non-zero if there are conflicts to resolve.
+
+Use 'mdd install-merge-driver' to configure git to use it.
+
+The arguments are:
+`
+	// Asked for help?
+	if displayHelp {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return nil
+	}
+
+	// FlagSet.Parse() will evaluate to false if no flags were parsed
+	if !flags.Parsed() {
+		return fmt.Errorf("Error parsing arguments")
+	}
+
+	// Git may also pass the pathname of the file being merged
+	if len(flags.Args()) < 3 || len(flags.Args()) > 4 {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return fmt.Errorf("Missing arguments")
+	}
+
+	args := flags.Args()
+	conflicts, err := MergeFiles(args[0], args[1], args[2])
+	if err != nil {
+		return err
+	}
+	if conflicts > 0 {
+		return fmt.Errorf("Merge of '%s' has %d conflicts", args[1], conflicts)
+	}
+	return nil
+}
+
+func doInstallMergeDriver(flags *flag.FlagSet, displayHelp bool) error {
+	helptext := `
+mdd install-merge-driver configures git to merge documents with 'mdd merge-driver'
+
+Usage:
+
+	mdd install-merge-driver
+
+Adds the documents to .gitattributes, in the directory containing .mdd, and adds
+the merge driver to the git config of the repository. Commit .gitattributes so it
+is shared, everyone merging documents needs to run this command once, since git
+doesnt share its config.
+
+The arguments are:
+`
+	// Asked for help?
+	if displayHelp {
+		fmt.Println(helptext)
+		flags.PrintDefaults()
+		return nil
+	}
+
+	// FlagSet.Parse() will evaluate to false if no flags were parsed
+	if !flags.Parsed() {
+		return fmt.Errorf("Error parsing arguments")
+	}
+
+	p, err := FindProjectBelowCwd(true)
+	if err != nil {
+		return err
+	}
+
+	attrPath, err := p.InstallMergeDriver()
+	if err != nil {
+		return err
+	}
+	log.Printf("%s", attrPath)
+	return nil
+}
@@ -0,0 +1,143 @@
+#!/usr/bin/env bats
+#
+# Test script for 'mdd config' command
+#
+
+setup() {
+  rm -rf ./.mdd
+}
+
+teardown() {
+  rm -rf ./.mdd
+  rm -rf ./site
+}
+
+@test "mdd config, missing arguments" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd config
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Cannot parse command line. Try 'mdd help config'" ]
+}
+
+@test "mdd config, unknown command" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd config foo
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Unknown config command 'foo', expected one of: list, get, set" ]
+}
+
+@test "mdd config list" {
+  $BATS_CWD/mdd init -p my-project
+  run $BATS_CWD/mdd config list
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "editor:" ]
+  [ "${lines[1]}" = "export.order:" ]
+  [ "${lines[2]}" = "ids.digits: 4" ]
+  [ "${lines[3]}" = "ids.scheme: user" ]
+  [ "${lines[4]}" = "project: my-project" ]
+  [ "${lines[5]}" = "publish.dir: publish" ]
+  [ "${lines[6]}" = "publish.trace-cols: att, itst" ]
+  [ "${lines[7]}" = "publish.trace-rows: req, nfr" ]
+  [ "${lines[8]}" = "verify.rules:" ]
+}
+
+@test "mdd config get" {
+  $BATS_CWD/mdd init -p my-project
+  run $BATS_CWD/mdd config get project
+  [ "$status" -eq 0 ]
+  [ "$output" = "my-project" ]
+}
+
+@test "mdd config get, unknown key" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd config get foo
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Unknown config key 'foo', expected one of: project, editor, publish.dir, publish.trace-rows, publish.trace-cols, ids.scheme, ids.digits, verify.rules, export.order" ]
+}
+
+@test "mdd config set" {
+  $BATS_CWD/mdd init -p my-project
+  run $BATS_CWD/mdd config set project other-project
+  [ "$status" -eq 0 ]
+  run $BATS_CWD/mdd config get project
+  [ "$output" = "other-project" ]
+  run grep "^project: other-project" ./.mdd/config.yaml
+  [ "$status" -eq 0 ]
+}
+
+@test "mdd config set, list" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd config set verify.rules "req links-to att itst" "adr linked-from mtg"
+  [ "$status" -eq 0 ]
+  run $BATS_CWD/mdd config get verify.rules
+  [ "${lines[0]}" = "req links-to att itst" ]
+  [ "${lines[1]}" = "adr linked-from mtg" ]
+}
+
+@test "mdd config set, single value" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd config set project a b
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Config key 'project' takes a single value" ]
+}
+
+@test "mdd config set, invalid values" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd config set ids.scheme foo
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Unknown ids.scheme 'foo', expected one of: user, project" ]
+  run $BATS_CWD/mdd config set ids.digits 0
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Invalid ids.digits '0', expected a number from 1 to 9" ]
+  run $BATS_CWD/mdd config set publish.trace-rows req foo
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "No such template: 'foo'" ]
+  run $BATS_CWD/mdd config set verify.rules "req needs att"
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Invalid verify rule 'req needs att', expected 'links-to' or 'linked-from' not 'needs'" ]
+}
+
+@test "mdd config set ids, changes new filenames" {
+  $BATS_CWD/mdd init -p demo
+  $BATS_CWD/mdd config set ids.scheme project
+  $BATS_CWD/mdd config set ids.digits 6
+  run $BATS_CWD/mdd new adr
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = ".mdd/documents/adr-fe-000001.md" ]
+}
+
+@test "mdd config set publish.dir" {
+  $BATS_CWD/mdd init
+  $BATS_CWD/mdd new adr
+  run $BATS_CWD/mdd config set publish.dir ../site
+  [ "$status" -eq 0 ]
+  run $BATS_CWD/mdd publish
+  [ "$status" -eq 0 ]
+  [ -f ./site/index.html ]
+}
+
+@test "mdd config set publish.dir, rejects project directories" {
+  $BATS_CWD/mdd init
+  for dir in documents templates templates-base . .. ../..; do
+    run $BATS_CWD/mdd config set publish.dir ${dir}
+    [ "$status" -eq 1 ]
+  done
+  run $BATS_CWD/mdd config set publish.dir documents
+  [ "${lines[0]}" = "Config key 'publish.dir' cant be 'documents', it contains the documents directory" ]
+  run $BATS_CWD/mdd config set publish.dir ..
+  [ "${lines[0]}" = "Config key 'publish.dir' cant be '..', it contains the project directory" ]
+  run $BATS_CWD/mdd config get publish.dir
+  [ "${lines[0]}" = "publish" ]
+}
+
+@test "mdd config, migrates project.data" {
+  $BATS_CWD/mdd init
+  rm ./.mdd/config.yaml
+  printf "# mdd project db file. Do not edit\nproject: old-project\nverify-rule: req links-to att itst\n" > ./.mdd/project.data
+  run $BATS_CWD/mdd config list
+  [ "$status" -eq 0 ]
+  [ "${lines[4]}" = "project: old-project" ]
+  [ "${lines[8]}" = "verify.rules: req links-to att itst" ]
+  [ ! -f ./.mdd/project.data ]
+  [ -f ./.mdd/config.yaml ]
+}
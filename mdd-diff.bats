@@ -0,0 +1,101 @@
+#!/usr/bin/env bats
+#
+# Test script for 'mdd diff' command
+#
+
+setup() {
+  rm -rf ./tmp/.mdd
+  rm -rf ./.mdd
+  rm -rf ./.git
+  git init -q .
+  git config user.email "test@example.com"
+  git config user.name "test"
+}
+
+@test "mdd diff, missing arguments" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd diff
+  [ "$status" -eq 1 ]
+}
+
+@test "mdd diff, unknown revision" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd diff nosuchrev
+  [ "$status" -eq 1 ]
+}
+
+@test "mdd diff, between revisions" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req "User login"))
+  att=$(basename $($BATS_CWD/mdd new att))
+  git add -A && git commit -qm "first"
+  git tag first
+  $BATS_CWD/mdd link -r verifies ${att} ${req}
+  $BATS_CWD/mdd status ${req} proposed
+  itst=$(basename $($BATS_CWD/mdd new itst "Login test"))
+  git add -A && git commit -qm "second"
+  run $BATS_CWD/mdd diff first HEAD
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "${att}" ]
+  [ "${lines[1]}" = "  link created -> ${req} (verifies)" ]
+  [ "${lines[2]}" = "${itst}" ]
+  [ "${lines[3]}" = "  added 'Login test'" ]
+  [ "${lines[4]}" = "${req}" ]
+  [ "${lines[5]}" = "  status draft -> proposed" ]
+}
+
+@test "mdd diff, working directory" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req "User login"))
+  att=$(basename $($BATS_CWD/mdd new att))
+  $BATS_CWD/mdd link ${att} ${req}
+  git add -A && git commit -qm "first"
+  rm ./.mdd/documents/${req}
+  echo "More detail" >> ./.mdd/documents/${att}
+  run $BATS_CWD/mdd diff HEAD
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "${att}" ]
+  [ "${lines[1]}" = "  body changed, 1 lines added, 0 removed" ]
+  [ "${lines[2]}" = "  link broken -> ${req}, it was removed" ]
+  [ "${lines[3]}" = "${req}" ]
+  [ "${lines[4]}" = "  removed 'User login'" ]
+}
+
+@test "mdd diff, template fields" {
+  $BATS_CWD/mdd init
+  printf "\n<!-- mdd-template\nmdd-field: priority enum(low,medium,high) default=medium\nmdd-field: owner string\n-->\n" >> ./.mdd/templates/req.md
+  req=$(basename $($BATS_CWD/mdd new req "User login"))
+  git add -A && git commit -qm "first"
+  $BATS_CWD/mdd set ${req} priority high
+  $BATS_CWD/mdd set ${req} owner Sue
+  run $BATS_CWD/mdd diff HEAD
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "${req}" ]
+  [ "${lines[1]}" = "  priority medium -> high" ]
+  [ "${lines[2]}" = "  owner set to Sue" ]
+}
+
+@test "mdd diff, describes versions that cant be read" {
+  $BATS_CWD/mdd init
+  printf "\n<!-- mdd-template\nmdd-field: effort int\n-->\n" >> ./.mdd/templates/req.md
+  req=$(basename $($BATS_CWD/mdd new req "User login"))
+  $BATS_CWD/mdd set ${req} effort 3
+  git add -A && git commit -qm "Add login"
+  sed -i.bak '/^<!-- mdd-template$/,$d' ./.mdd/templates/req.md
+  sed -i.bak '/^mdd-effort: /d' ./.mdd/documents/${req}
+  rm ./.mdd/templates/req.md.bak ./.mdd/documents/${req}.bak
+  $BATS_CWD/mdd tag ${req} security
+  git add -A && git commit -qm "Drop effort"
+  run $BATS_CWD/mdd diff HEAD~1 HEAD
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "${req}" ]
+  [ $(expr "${lines[1]}" : "  cant compare, the previous version cant be read: .*mdd-effort") -ne 0 ]
+  [ "${#lines[@]}" -eq 2 ]
+  sed 's/^mdd-status: /mdd-effort: 5\nmdd-status: /' ./.mdd/documents/${req} > ./.mdd/documents/${req}.new
+  mv ./.mdd/documents/${req}.new ./.mdd/documents/${req}
+  run $BATS_CWD/mdd diff HEAD
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "${req}" ]
+  [ $(expr "${lines[1]}" : "  cant compare, this version cant be read: .*mdd-effort") -ne 0 ]
+  [ "${#lines[@]}" -eq 2 ]
+}
@@ -0,0 +1,123 @@
+#!/usr/bin/env bats
+#
+# Test script for 'mdd export' command
+#
+
+setup() {
+  rm -rf ./.mdd
+  rm -f ./export.html ./export.epub
+}
+
+teardown() {
+  rm -f ./export.html ./export.epub
+}
+
+@test "mdd export, missing project" {
+  run $BATS_CWD/mdd export
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "No project found" ]
+}
+
+@test "mdd export, unknown format" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd export -format pdf
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Unknown format 'pdf', expected one of: md, html, epub" ]
+}
+
+@test "mdd export, table of contents grouped by template" {
+  $BATS_CWD/mdd init -p demo
+  req=$(basename $($BATS_CWD/mdd new req "Login page") .md)
+  att=$(basename $($BATS_CWD/mdd new att "Login test") .md)
+  run $BATS_CWD/mdd export
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "# demo" ]
+  [ "${lines[1]}" = "## Contents" ]
+  [ "${lines[2]}" = "- [Automated test](#template-att)" ]
+  [ "${lines[3]}" = "    - [${att} Login test](#${att})" ]
+  [ "${lines[4]}" = "- [Functional Requirement](#template-req)" ]
+  [ "${lines[5]}" = "    - [${req} Login page](#${req})" ]
+  [ "${lines[6]}" = "- [Appendix: Traceability](#appendix-traceability)" ]
+}
+
+@test "mdd export, export.order config" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req "Login page") .md)
+  att=$(basename $($BATS_CWD/mdd new att "Login test") .md)
+  run $BATS_CWD/mdd config set export.order req
+  [ "$status" -eq 0 ]
+  run $BATS_CWD/mdd export
+  [ "$status" -eq 0 ]
+  [ "${lines[2]}" = "- [Functional Requirement](#template-req)" ]
+  [ "${lines[4]}" = "- [Automated test](#template-att)" ]
+  run $BATS_CWD/mdd config set export.order xyz
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "No such template: 'xyz'" ]
+}
+
+@test "mdd export, documents without metadata and with anchors" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req "Login page") .md)
+  run $BATS_CWD/mdd export
+  [ "$status" -eq 0 ]
+  echo "$output" | grep -q "^<a id=\"${req}\"></a>$"
+  echo "$output" | grep -q "^## Login page$"
+  echo "$output" | grep -q "^\*${req}.md, status: draft\*$"
+  run grep -c "mdd-status" <(echo "$output")
+  [ "${lines[0]}" = "0" ]
+}
+
+@test "mdd export, inline links point at anchors" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req "Login page") .md)
+  att=$(basename $($BATS_CWD/mdd new att "Login test") .md)
+  $BATS_CWD/mdd link -r verifies ${att}.md ${req}.md
+  echo "See [the requirement](${req}.md#standown-period)." >> ./.mdd/documents/${att}.md
+  run $BATS_CWD/mdd export
+  [ "$status" -eq 0 ]
+  echo "$output" | grep -q "^See \[the requirement\](#${req})\.$"
+  echo "$output" | grep -q "^Links to: \[${req}\](#${req}) (verifies)$"
+}
+
+@test "mdd export, traceability appendix" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req "Login page") .md)
+  att=$(basename $($BATS_CWD/mdd new att "Login test") .md)
+  $BATS_CWD/mdd link -r verifies ${att}.md ${req}.md
+  run $BATS_CWD/mdd export
+  [ "$status" -eq 0 ]
+  echo "$output" | grep -q "^# Appendix: Traceability$"
+  echo "$output" | grep -q "^| Document | Title | \[${att}\](#${att}) |$"
+  echo "$output" | grep -q "^| \[${req}\](#${req}) | Login page | X |$"
+  echo "$output" | grep -q "^Coverage: 1/1 (100%)$"
+}
+
+@test "mdd export, html" {
+  $BATS_CWD/mdd init -p demo
+  req=$(basename $($BATS_CWD/mdd new req "Login page") .md)
+  run $BATS_CWD/mdd export -format html -o export.html
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "Exported 1 documents to export.html" ]
+  grep -q "<title>demo</title>" ./export.html
+  grep -q "<a id=\"${req}\"></a>" ./export.html
+  grep -q "<a href=\"#${req}\" rel=\"nofollow\">${req} Login page</a>" ./export.html
+}
+
+@test "mdd export, epub" {
+  $BATS_CWD/mdd init -p demo
+  $BATS_CWD/mdd new req "Login page"
+  run $BATS_CWD/mdd export -format epub
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Missing 'o' argument, the epub format must be written to a file" ]
+  run $BATS_CWD/mdd export -format epub -o export.epub
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "Exported 1 documents to export.epub" ]
+  run unzip -Z1 ./export.epub
+  [ "${lines[0]}" = "mimetype" ]
+  [ "${lines[1]}" = "META-INF/container.xml" ]
+  [ "${lines[2]}" = "OEBPS/content.opf" ]
+  [ "${lines[3]}" = "OEBPS/nav.xhtml" ]
+  [ "${lines[4]}" = "OEBPS/content.xhtml" ]
+  run unzip -p ./export.epub mimetype
+  [ "$output" = "application/epub+zip" ]
+}
@@ -0,0 +1,106 @@
+#!/usr/bin/env bats
+#
+# Test script for 'mdd graph' command
+#
+
+setup() {
+  rm -rf ./tmp/.mdd
+  rm -rf ./.mdd
+}
+
+@test "mdd graph, missing project" {
+  run $BATS_CWD/mdd graph
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "No project found" ]
+}
+
+@test "mdd graph, dot" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  att=$(basename $($BATS_CWD/mdd new att))
+  $BATS_CWD/mdd link -r verifies ${att} ${req}
+  run $BATS_CWD/mdd graph
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "digraph mdd {" ]
+  [ $(expr "$output" : ".*\"${req}\" \[label=\"${req}\\\\n.*fillcolor=\"#") -ne 0 ]
+  [ $(expr "$output" : ".*\"${att}\" -> \"${req}\" \[label=\"verifies\"\];") -ne 0 ]
+}
+
+@test "mdd graph, mermaid" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  att=$(basename $($BATS_CWD/mdd new att))
+  $BATS_CWD/mdd link ${att} ${req}
+  run $BATS_CWD/mdd graph -format mermaid
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "graph LR" ]
+  a=${att%.md}
+  r=${req%.md}
+  [ $(expr "$output" : ".*${a//-/_} --> ${r//-/_}") -ne 0 ]
+  [ $(expr "$output" : ".*classDef req fill:#") -ne 0 ]
+}
+
+@test "mdd graph, graphml" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  att=$(basename $($BATS_CWD/mdd new att))
+  $BATS_CWD/mdd link -r verifies ${att} ${req}
+  run $BATS_CWD/mdd graph -format graphml
+  [ "$status" -eq 0 ]
+  [ $(expr "$output" : ".*<node id=\"${req}\">") -ne 0 ]
+  [ $(expr "$output" : ".*<edge source=\"${att}\" target=\"${req}\">") -ne 0 ]
+  [ $(expr "$output" : ".*<data key=\"relation\">verifies</data>") -ne 0 ]
+}
+
+@test "mdd graph, template filter" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  att=$(basename $($BATS_CWD/mdd new att))
+  $BATS_CWD/mdd link ${att} ${req}
+  run $BATS_CWD/mdd graph -template req
+  [ "$status" -eq 0 ]
+  [ $(expr "$output" : ".*${req}") -ne 0 ]
+  [ $(expr "$output" : ".*${att}") -eq 0 ]
+}
+
+@test "mdd graph, tag filter" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  att=$(basename $($BATS_CWD/mdd new att))
+  $BATS_CWD/mdd tag ${att} security
+  run $BATS_CWD/mdd graph -tag security
+  [ "$status" -eq 0 ]
+  [ $(expr "$output" : ".*${att}") -ne 0 ]
+  [ $(expr "$output" : ".*${req}") -eq 0 ]
+}
+
+@test "mdd graph, root and depth" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  adr=$(basename $($BATS_CWD/mdd new adr))
+  itst=$(basename $($BATS_CWD/mdd new itst))
+  att=$(basename $($BATS_CWD/mdd new att))
+  $BATS_CWD/mdd link ${req} ${adr}
+  $BATS_CWD/mdd link ${adr} ${itst}
+  run $BATS_CWD/mdd graph -root ${req} -depth 1
+  [ "$status" -eq 0 ]
+  [ $(expr "$output" : ".*${adr}") -ne 0 ]
+  [ $(expr "$output" : ".*${itst}") -eq 0 ]
+  [ $(expr "$output" : ".*${att}") -eq 0 ]
+  run $BATS_CWD/mdd graph -root ${req}
+  [ $(expr "$output" : ".*${itst}") -ne 0 ]
+}
+
+@test "mdd graph, unknown root" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd graph -root missing.md
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Cant find document 'missing.md'" ]
+}
+
+@test "mdd graph, unknown format" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd graph -format png
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Unknown format 'png', expected one of: dot, mermaid, graphml" ]
+}
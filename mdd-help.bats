@@ -17,7 +17,7 @@
 @test "mdd help templates" {
   run $BATS_CWD/mdd help templates
   [ "$status" -eq 0 ]
-  [ "${lines[0]}" = "mdd templates lists the templates available" ]
+  [ "${lines[0]}" = "mdd templates lists and manages the templates available" ]
 }
 
 @test "mdd help new" {
@@ -79,3 +79,9 @@
   [ "$status" -eq 0 ]
   [ "${lines[0]}" = "mdd publish creates a static website for the mdd repository" ]
 }
+
+@test "mdd help export" {
+  run $BATS_CWD/mdd help export
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "mdd export combines every document into a single file" ]
+}
@@ -0,0 +1,76 @@
+#!/usr/bin/env bats
+#
+# Test script for 'mdd history' command
+#
+
+setup() {
+  rm -rf ./tmp/.mdd
+  rm -rf ./.mdd
+  rm -rf ./.git
+  git init -q .
+  git config user.email "test@example.com"
+  git config user.name "test"
+}
+
+@test "mdd history, missing arguments" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd history
+  [ "$status" -eq 1 ]
+}
+
+@test "mdd history, no history" {
+  $BATS_CWD/mdd init
+  git add -A && git commit -qm "init"
+  req=$(basename $($BATS_CWD/mdd new req))
+  run $BATS_CWD/mdd history ${req}
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "No history found for document '${req}'" ]
+}
+
+@test "mdd history, lists changes per commit" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req "User login"))
+  att=$(basename $($BATS_CWD/mdd new att))
+  git add -A && git commit -qm "Add login"
+  $BATS_CWD/mdd tag ${req} security
+  $BATS_CWD/mdd link ${req} ${att}
+  git commit -qam "Tag and link login"
+  run $BATS_CWD/mdd history ${req}
+  [ "$status" -eq 0 ]
+  [ $(expr "${lines[0]}" : "^[0-9a-f]* [0-9-]* test  Tag and link login$") -ne 0 ]
+  [ "${lines[1]}" = "  tag added #security" ]
+  [ "${lines[2]}" = "  link created -> ${att}" ]
+  [ $(expr "${lines[3]}" : ".*Add login$") -ne 0 ]
+  [ "${lines[4]}" = "  added 'User login'" ]
+}
+
+@test "mdd history, follows renames" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req "User login"))
+  git add -A && git commit -qm "Add login"
+  $BATS_CWD/mdd mv ${req} req-00-0009
+  git add -A && git commit -qm "Rename login"
+  run $BATS_CWD/mdd history req-00-0009
+  [ "$status" -eq 0 ]
+  [ "${lines[1]}" = "  renamed from ${req}" ]
+  [ "${lines[3]}" = "  added 'User login'" ]
+}
+
+@test "mdd history, describes versions that cant be read" {
+  $BATS_CWD/mdd init
+  printf "\n<!-- mdd-template\nmdd-field: effort int\n-->\n" >> ./.mdd/templates/req.md
+  req=$(basename $($BATS_CWD/mdd new req "User login"))
+  $BATS_CWD/mdd set ${req} effort 3
+  git add -A && git commit -qm "Add login"
+  sed -i.bak '/^<!-- mdd-template$/,$d' ./.mdd/templates/req.md
+  sed -i.bak '/^mdd-effort: /d' ./.mdd/documents/${req}
+  rm ./.mdd/templates/req.md.bak ./.mdd/documents/${req}.bak
+  $BATS_CWD/mdd tag ${req} security
+  git add -A && git commit -qm "Drop effort"
+  run $BATS_CWD/mdd history ${req}
+  [ "$status" -eq 0 ]
+  [ $(expr "${lines[0]}" : ".*Drop effort$") -ne 0 ]
+  [ $(expr "${lines[1]}" : "  cant compare, the previous version cant be read: .*mdd-effort") -ne 0 ]
+  [ $(expr "${lines[2]}" : ".*Add login$") -ne 0 ]
+  [ $(expr "${lines[3]}" : "  cant compare, this version cant be read: .*mdd-effort") -ne 0 ]
+}
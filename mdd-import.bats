@@ -0,0 +1,129 @@
+#!/usr/bin/env bats
+#
+# Test script for 'mdd import' command
+#
+
+setup() {
+  rm -rf ./.mdd
+  rm -rf ./old
+  mkdir -p ./old/sub
+  printf "# Use Go\n\nSee [the database](sub/use-postgres.md#why).\n" > ./old/use-go.md
+  printf "# Use Postgres\n\nBecause of [Go](../use-go.md).\n" > ./old/sub/use-postgres.md
+}
+
+teardown() {
+  rm -rf ./old
+}
+
+@test "mdd import, missing arguments" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd import
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Cannot parse command line. Try 'mdd help import'" ]
+  run $BATS_CWD/mdd import ./old
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Missing 'template' argument" ]
+  run $BATS_CWD/mdd import ./old -template xyz
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "No such template: 'xyz'" ]
+}
+
+@test "mdd import, directory" {
+  $BATS_CWD/mdd init
+  $BATS_CWD/mdd new adr
+  run $BATS_CWD/mdd import ./old --template adr
+  [ "$status" -eq 0 ]
+  [ $(expr "${lines[0]}" : "old/sub/use-postgres.md -> adr-.*-0002.md") -ne 0 ]
+  [ $(expr "${lines[2]}" : "old/use-go.md -> adr-.*-0003.md") -ne 0 ]
+  [ ! -f ./old/use-go.md ]
+  run $BATS_CWD/mdd ls -1 -where 'title~use'
+  [ "${#lines[@]}" -eq 2 ]
+  go=${lines[1]}
+  postgres=${lines[0]}
+  run grep "mdd-status: draft" ./.mdd/documents/${go}
+  [ "$status" -eq 0 ]
+  # Links between the imported files are left alone, and reported
+  run grep "\[the database\](sub/use-postgres.md#why)" ./.mdd/documents/${go}
+  [ "$status" -eq 0 ]
+  run grep "mdd-child" ./.mdd/documents/${go}
+  [ "$status" -eq 1 ]
+}
+
+@test "mdd import, reports links that wont resolve" {
+  $BATS_CWD/mdd init
+  printf "# Use Go\n\nSee [the database](sub/use-postgres.md#why) and ![diagram](arch.png).\n" > ./old/use-go.md
+  run $BATS_CWD/mdd import ./old/use-go.md -template adr
+  [ "$status" -eq 0 ]
+  [ "${lines[1]}" = "  Link 'sub/use-postgres.md#why' wont resolve, 'sub/use-postgres.md' isnt being imported" ]
+  [ "${lines[2]}" = "  Link 'arch.png' wont resolve, 'arch.png' doesnt exist" ]
+  run $BATS_CWD/mdd import ./old/sub/use-postgres.md -template adr
+  [ "$status" -eq 0 ]
+  [ "${lines[1]}" = "  Link '../use-go.md' wont resolve, '../use-go.md' isnt being imported" ]
+}
+
+@test "mdd import, links to other files" {
+  $BATS_CWD/mdd init
+  printf "# Use Go\n\n![diagram](arch.png)\n" > ./old/use-go.md
+  touch ./old/arch.png
+  run $BATS_CWD/mdd import ./old/use-go.md -template req
+  [ "$status" -eq 0 ]
+  [ "${#lines[@]}" -eq 1 ]
+  go=$(basename $(echo ${lines[0]} | cut -d ' ' -f 3))
+  grep -q "!\[diagram\](../../old/arch.png)" ./.mdd/documents/${go}
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 0 ]
+}
+
+@test "mdd import, verify after import" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd import ./old -template req
+  [ "$status" -eq 0 ]
+  [ "${lines[1]}" = "  Link '../use-go.md' wont resolve, use -link to change links between imported files to child links" ]
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 1 ]
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  mkdir -p ./old/sub
+  printf "# Use Go\n\nSee [the database](sub/use-postgres.md#why).\n" > ./old/use-go.md
+  printf "# Use Postgres\n\nBecause of [Go](../use-go.md).\n" > ./old/sub/use-postgres.md
+  run $BATS_CWD/mdd import -link ./old -template req
+  [ "$status" -eq 0 ]
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 0 ]
+  [ "${#lines[@]}" -eq 0 ]
+}
+
+@test "mdd import -link" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd import -link -template adr ./old/use-go.md ./old/sub/use-postgres.md
+  [ "$status" -eq 0 ]
+  go=$(basename $(echo ${lines[0]} | cut -d ' ' -f 3))
+  postgres=$(basename $(echo ${lines[2]} | cut -d ' ' -f 3))
+  [ "${lines[1]}" = "  -> ${postgres}" ]
+  [ "${lines[3]}" = "  -> ${go}" ]
+  run $BATS_CWD/mdd parents ${go}
+  [ $(expr "${lines[0]}" : "^${postgres}") -ne 0 ]
+}
+
+@test "mdd import -n, changes nothing" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd import -n ./old -template mtg
+  [ "$status" -eq 0 ]
+  [ "${#lines[@]}" -eq 4 ]
+  [ -f ./old/use-go.md ]
+  run $BATS_CWD/mdd ls
+  [ "${#lines[@]}" -eq 0 ]
+}
+
+@test "mdd import, reports files it cant import" {
+  $BATS_CWD/mdd init
+  printf "Some notes\n" > ./old/notes.md
+  printf "# Notes\n\n<!-- mdd\nmdd-status: draft\n-->\n" > ./old/done.md
+  run $BATS_CWD/mdd import ./old -template adr
+  [ "$status" -eq 1 ]
+  [ $(expr "${lines[0]}" : "old/sub/use-postgres.md -> adr-.*-0001.md") -ne 0 ]
+  [ "${lines[4]}" = "Cant import 'old/done.md', it already has a mdd metadata block" ]
+  [ "${lines[5]}" = "Cant import 'old/notes.md', it has no title, a heading like '# Title' using letters, digits, spaces and '-.~'" ]
+  [ "${lines[6]}" = "Total 2 files not imported" ]
+  [ -f ./old/notes.md ]
+}
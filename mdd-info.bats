@@ -25,14 +25,21 @@ teardown() {
   [ "$status" -eq 0 ]
 }
 
+@test "mdd info, project name" {
+  $BATS_CWD/mdd init -p my-project
+  run $BATS_CWD/mdd info
+  [ "$status" -eq 0 ]
+  [ "${lines[2]}" = "project   : my-project" ]
+}
+
 @test "mdd info, 1 file" {
   $BATS_CWD/mdd init
   $BATS_CWD/mdd new adr
   run $BATS_CWD/mdd info
   [ "$status" -eq 0 ]
-  [ "${lines[2]}" = "path      : .mdd" ]
-  [ "${lines[3]}" = "templates : 6" ]
-  [ "${lines[4]}" = "documents : 1" ]
+  [ "${lines[3]}" = "path      : .mdd" ]
+  [ "${lines[4]}" = "templates : 6" ]
+  [ "${lines[5]}" = "documents : 1" ]
 }
 
 @test "mdd info, different path" {
@@ -42,9 +49,9 @@ teardown() {
   $BATS_CWD/mdd new adr
   run $BATS_CWD/mdd info
   [ "$status" -eq 0 ]
-  [ "${lines[2]}" = "path      : tmp/.mdd" ]
-  [ "${lines[3]}" = "templates : 6" ]
-  [ "${lines[4]}" = "documents : 1" ]
+  [ "${lines[3]}" = "path      : tmp/.mdd" ]
+  [ "${lines[4]}" = "templates : 6" ]
+  [ "${lines[5]}" = "documents : 1" ]
 }
 
 @test "mdd info, 10 files" {
@@ -55,7 +62,26 @@ teardown() {
   done
   run $BATS_CWD/mdd info
   [ "$status" -eq 0 ]
-  [ "${lines[2]}" = "path      : .mdd" ]
-  [ "${lines[3]}" = "templates : 6" ]
-  [ "${lines[4]}" = "documents : 10" ]
+  [ "${lines[3]}" = "path      : .mdd" ]
+  [ "${lines[4]}" = "templates : 6" ]
+  [ "${lines[5]}" = "documents : 10" ]
+}
+
+@test "mdd info --format json" {
+  $BATS_CWD/mdd init -p my-project
+  $BATS_CWD/mdd new adr
+  run $BATS_CWD/mdd info --format json
+  [ "$status" -eq 0 ]
+  [ "${lines[1]}" = '  "project": "my-project",' ]
+  [ "${lines[2]}" = '  "path": ".mdd",' ]
+  [ "${lines[3]}" = '  "templates": 6,' ]
+  [ "${lines[4]}" = '  "documents": 1' ]
+}
+
+@test "mdd info --format csv" {
+  $BATS_CWD/mdd init -p my-project
+  run $BATS_CWD/mdd info --format csv
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "project,path,templates,documents" ]
+  [ "${lines[1]}" = "my-project,.mdd,6,0" ]
 }
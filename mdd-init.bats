@@ -19,16 +19,17 @@ teardown() {
   [ "$status" -eq 0 ]
   [ "${lines[0]}" = "." ]
   [ "${lines[1]}" = ".." ]
-  [ "${lines[2]}" = "documents" ]
-  [ "${lines[3]}" = "project.data" ]
+  [ "${lines[2]}" = "config.yaml" ]
+  [ "${lines[3]}" = "documents" ]
   [ "${lines[4]}" = "publish" ]
   [ "${lines[5]}" = "templates" ]
+  [ "${lines[6]}" = "templates-base" ]
 }
 
 @test "mdd init -p, saves project meta-data" {
   rm -rf ./.mdd
   run $BATS_CWD/mdd init -p my-project
-  run cat ./.mdd/project.data
+  run cat ./.mdd/config.yaml
   [ "${lines[1]}" = "project: my-project" ]
 }
 
@@ -46,9 +47,10 @@ teardown() {
   [ "$status" -eq 0 ]
   [ "${lines[0]}" = "." ]
   [ "${lines[1]}" = ".." ]
-  [ "${lines[2]}" = "documents" ]
-  [ "${lines[3]}" = "project.data" ]
+  [ "${lines[2]}" = "config.yaml" ]
+  [ "${lines[3]}" = "documents" ]
   [ "${lines[4]}" = "publish" ]
   [ "${lines[5]}" = "templates" ]
+  [ "${lines[6]}" = "templates-base" ]
 }
 
@@ -112,4 +112,39 @@ setup() {
     run grep "mdd-child: ${child}" $parent_path
     [ "$status" -eq 0 ]
   done
-}
\ No newline at end of file
+}
+
+@test "mdd link, typed relation" {
+  $BATS_CWD/mdd init
+  parent_path=$($BATS_CWD/mdd new att)
+  parent=$(basename ${parent_path})
+  child=$(basename $($BATS_CWD/mdd new req))
+  run $BATS_CWD/mdd link -r verifies ${parent} ${child}
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "${parent} -> ${child} (verifies)" ]
+  run grep "mdd-child-verifies: ${child}" $parent_path
+  [ "$status" -eq 0 ]
+}
+
+@test "mdd link, relink changes relation" {
+  $BATS_CWD/mdd init
+  parent_path=$($BATS_CWD/mdd new adr)
+  parent=$(basename ${parent_path})
+  child=$(basename $($BATS_CWD/mdd new adr))
+  $BATS_CWD/mdd link ${parent} ${child}
+  run $BATS_CWD/mdd link -r supersedes ${parent} ${child}
+  [ "$status" -eq 0 ]
+  run grep "mdd-child-supersedes: ${child}" $parent_path
+  [ "$status" -eq 0 ]
+  run grep "mdd-child: ${child}" $parent_path
+  [ "$status" -eq 1 ]
+}
+
+@test "mdd link, unknown relation" {
+  $BATS_CWD/mdd init
+  parent=$(basename $($BATS_CWD/mdd new adr))
+  child=$(basename $($BATS_CWD/mdd new adr))
+  run $BATS_CWD/mdd link -r likes ${parent} ${child}
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Unknown link relation 'likes', expected one of: verifies, supersedes, refines, decided-in, blocks" ]
+}
@@ -57,7 +57,9 @@ setup() {
   [ $(expr "${lines[0]}" : ".*#foo.*") -ne 0 ]
   [ $(expr "${lines[0]}" : ".*#bar.*") -ne 0 ]
   [ $(expr "${lines[1]}" : ".*-> ${child}.*") -ne 0 ]
-  [ $(expr "${lines[2]}" : "^${child}.*") -ne 0 ]
+  [ $(expr "${lines[2]}" : "^  created .* by .*, modified .* by .*") -ne 0 ]
+  [ $(expr "${lines[3]}" : "^${child}.*") -ne 0 ]
+  [ $(expr "${lines[5]}" : "^  created .* by .*") -ne 0 ]
 }
 
 @test "mdd ls -l, circular link" {
@@ -71,6 +73,148 @@ setup() {
   [ "$status" -eq 0 ]
   [ $(expr "${lines[0]}" : "^${parent}.*") -ne 0 ]
   [ $(expr "${lines[1]}" : ".*-> ${child}.*") -ne 0 ]
-  [ $(expr "${lines[2]}" : "^${child}.*") -ne 0 ]
-  [ $(expr "${lines[3]}" : ".*-> ${parent}.*") -ne 0 ]
+  [ $(expr "${lines[2]}" : ".*<- ${child}.*") -ne 0 ]
+  [ $(expr "${lines[4]}" : "^${child}.*") -ne 0 ]
+  [ $(expr "${lines[5]}" : ".*-> ${parent}.*") -ne 0 ]
+  [ $(expr "${lines[6]}" : ".*<- ${parent}.*") -ne 0 ]
+}
+
+@test "mdd ls -l, shows link relation" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  parent=$(basename $($BATS_CWD/mdd new att))
+  child=$(basename $($BATS_CWD/mdd new req))
+  $BATS_CWD/mdd link -r verifies ${parent} ${child}
+  run $BATS_CWD/mdd ls -l
+  [ "$status" -eq 0 ]
+  [ $(expr "${lines[1]}" : ".*-> ${child}.*(verifies)") -ne 0 ]
+}
+
+@test "mdd ls -l, shows parents" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  parent=$(basename $($BATS_CWD/mdd new att))
+  child=$(basename $($BATS_CWD/mdd new req))
+  $BATS_CWD/mdd link -r verifies ${parent} ${child}
+  run $BATS_CWD/mdd ls -l
+  [ "$status" -eq 0 ]
+  [ $(expr "${lines[3]}" : "^${child}.*") -ne 0 ]
+  [ $(expr "${lines[4]}" : ".*<- ${parent}.*(verifies)") -ne 0 ]
+}
+
+@test "mdd ls -l, shows fields" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  printf "\n<!-- mdd-template\nmdd-field: priority enum(low,medium,high) default=medium\nmdd-field: owner string\n-->\n" >> ./.mdd/templates/req.md
+  req=$(basename $($BATS_CWD/mdd new req))
+  $BATS_CWD/mdd set ${req} owner Sue
+  run $BATS_CWD/mdd ls -l
+  [ "$status" -eq 0 ]
+  [ "${lines[1]}" = "  priority: medium" ]
+  [ "${lines[2]}" = "  owner: Sue" ]
+  run $BATS_CWD/mdd ls --format csv
+  [ $(expr "${lines[1]}" : "${req},Functional Requirement,req,draft,,,priority=medium owner=Sue,.*") -ne 0 ]
+}
+
+@test "mdd ls --format csv" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  parent=$(basename $($BATS_CWD/mdd new att "Login test"))
+  child=$(basename $($BATS_CWD/mdd new req "Login"))
+  $BATS_CWD/mdd link -r verifies ${parent} ${child}
+  $BATS_CWD/mdd tag ${child} security web
+  run $BATS_CWD/mdd ls --format csv
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "filename,title,template,status,tags,children,fields,author,created,modified-by,modified-at" ]
+  [ $(expr "${lines[1]}" : "${parent},Login test,att,draft,,${child}:verifies,,.*") -ne 0 ]
+  [ $(expr "${lines[2]}" : "${child},Login,req,draft,security web,,,.*") -ne 0 ]
+}
+
+@test "mdd ls --format json" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  $BATS_CWD/mdd new adr "Framework"
+  run $BATS_CWD/mdd ls --format json
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "[" ]
+  [ $(expr "${lines[2]}" : '.*"filename": "adr-.*md"') -ne 0 ]
+  [ "${lines[3]}" = '    "title": "Framework",' ]
+  [ "${lines[4]}" = '    "template": "adr",' ]
+  [ "${lines[5]}" = '    "status": "draft",' ]
+}
+
+@test "mdd ls -where" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  login=$(basename $($BATS_CWD/mdd new req "User login"))
+  reset=$(basename $($BATS_CWD/mdd new req "Password reset"))
+  att=$(basename $($BATS_CWD/mdd new att "Login test"))
+  itst=$(basename $($BATS_CWD/mdd new itst "Login integration"))
+  $BATS_CWD/mdd link ${login} ${att}
+  $BATS_CWD/mdd link ${att} ${itst}
+  $BATS_CWD/mdd tag ${login} security
+  $BATS_CWD/mdd tag ${reset} security
+  run $BATS_CWD/mdd ls -1 -where 'template=req and tag=security and not linked-to(template=att)'
+  [ "$status" -eq 0 ]
+  [ "${#lines[@]}" -eq 1 ]
+  [ "${lines[0]}" = "${reset}" ]
+  run $BATS_CWD/mdd ls -1 -where 'title~"LOGIN" and template!=itst'
+  [ "$status" -eq 0 ]
+  [ "${#lines[@]}" -eq 2 ]
+  [ "${lines[0]}" = "${att}" ]
+  [ "${lines[1]}" = "${login}" ]
+}
+
+@test "mdd ls -where, links" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req "Login"))
+  att=$(basename $($BATS_CWD/mdd new att "Login test"))
+  itst=$(basename $($BATS_CWD/mdd new itst "Login integration"))
+  $BATS_CWD/mdd link ${req} ${att}
+  $BATS_CWD/mdd link ${att} ${itst}
+  run $BATS_CWD/mdd ls -1 -where 'links-to(template=itst)'
+  [ "${#lines[@]}" -eq 1 ]
+  [ "${lines[0]}" = "${att}" ]
+  run $BATS_CWD/mdd ls -1 -where 'linked-from(template=att)'
+  [ "${#lines[@]}" -eq 1 ]
+  [ "${lines[0]}" = "${itst}" ]
+  run $BATS_CWD/mdd ls -1 -where 'reaches(template=itst) and template=req'
+  [ "${#lines[@]}" -eq 1 ]
+  [ "${lines[0]}" = "${req}" ]
+  run $BATS_CWD/mdd ls -1 -where "reached-from(filename=${req%.md})"
+  [ "${#lines[@]}" -eq 2 ]
+  [ "${lines[0]}" = "${att}" ]
+  [ "${lines[1]}" = "${itst}" ]
+}
+
+@test "mdd ls -where, fields" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  printf "\n<!-- mdd-template\nmdd-field: priority enum(low,medium,high) default=medium\n-->\n" >> ./.mdd/templates/req.md
+  low=$(basename $($BATS_CWD/mdd new req))
+  high=$(basename $($BATS_CWD/mdd new req))
+  $BATS_CWD/mdd set ${low} priority low
+  $BATS_CWD/mdd set ${high} priority high
+  run $BATS_CWD/mdd ls -1 -where 'priority=high or priority=medium'
+  [ "$status" -eq 0 ]
+  [ "${#lines[@]}" -eq 1 ]
+  [ "${lines[0]}" = "${high}" ]
+}
+
+@test "mdd ls -where, invalid expressions" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd ls -where 'colour=red'
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Invalid where expression 'colour=red', unknown name 'colour', expected one of: template, tag, status, title, filename, author, or a template field" ]
+  run $BATS_CWD/mdd ls -where '(template=req'
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Invalid where expression '(template=req', expected ')' at the end" ]
+  run $BATS_CWD/mdd ls -where 'links-to template=req'
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Invalid where expression 'links-to template=req', expected '(' not 'template'" ]
+  run $BATS_CWD/mdd ls -where 'template=req template=att'
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Invalid where expression 'template=req template=att', unexpected 'template'" ]
 }
@@ -0,0 +1,101 @@
+#!/usr/bin/env bats
+#
+# Test script for 'mdd merge-driver' and 'mdd install-merge-driver' commands
+#
+
+setup() {
+  rm -rf ./tmp/.mdd
+  rm -rf ./.mdd
+  rm -f base ours theirs .gitattributes
+}
+
+# Writes a document to $1, with the remaining arguments as metadata lines
+write_doc() {
+  file=$1
+  shift
+  printf "# Login\n\nSome text\n\n<!-- mdd\n" > ${file}
+  for meta in "$@"; do
+    echo "${meta}" >> ${file}
+  done
+  echo "-->" >> ${file}
+}
+
+@test "mdd merge-driver, missing arguments" {
+  run $BATS_CWD/mdd merge-driver base ours
+  [ "$status" -eq 1 ]
+}
+
+@test "mdd merge-driver, merges tags and children as sets" {
+  write_doc base "mdd-status: draft" "mdd-child: req-aa-0001.md" "mdd-tag: old"
+  write_doc ours "mdd-status: draft" "mdd-child: req-aa-0001.md" "mdd-child: att-aa-0002.md" "mdd-tag: login"
+  write_doc theirs "mdd-status: proposed" "mdd-child-verifies: itst-aa-0003.md" "mdd-tag: old" "mdd-tag: security"
+  run $BATS_CWD/mdd merge-driver base ours theirs
+  [ "$status" -eq 0 ]
+  run cat ours
+  [ "${lines[0]}" = "# Login" ]
+  [ "${lines[2]}" = "<!-- mdd" ]
+  [ "${lines[3]}" = "mdd-status: proposed" ]
+  [ "${lines[4]}" = "mdd-child: att-aa-0002.md" ]
+  [ "${lines[5]}" = "mdd-child-verifies: itst-aa-0003.md" ]
+  [ "${lines[6]}" = "mdd-tag: login" ]
+  [ "${lines[7]}" = "mdd-tag: security" ]
+  [ "${lines[8]}" = "-->" ]
+}
+
+@test "mdd merge-driver, conflicting status" {
+  write_doc base "mdd-status: draft"
+  write_doc ours "mdd-status: proposed"
+  write_doc theirs "mdd-status: deprecated"
+  run $BATS_CWD/mdd merge-driver base ours theirs
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Merge of 'ours' has 1 conflicts" ]
+  grep -q "<<<<<<< ours" ours
+  grep -q "mdd-status: deprecated" ours
+}
+
+@test "mdd merge-driver, keeps the latest last modified" {
+  write_doc base "mdd-status: draft" "mdd-author: Fred"
+  write_doc ours "mdd-status: draft" "mdd-author: Fred" "mdd-last-modified-by: Bob" "mdd-last-modified-at: 2019-01-01T10:00:00Z"
+  write_doc theirs "mdd-status: draft" "mdd-author: Fred" "mdd-last-modified-by: Sue" "mdd-last-modified-at: 2019-02-01T10:00:00Z"
+  run $BATS_CWD/mdd merge-driver base ours theirs
+  [ "$status" -eq 0 ]
+  run cat ours
+  [ "${lines[3]}" = "mdd-status: draft" ]
+  [ "${lines[4]}" = "mdd-author: Fred" ]
+  [ "${lines[5]}" = "mdd-last-modified-by: Sue" ]
+  [ "${lines[6]}" = "mdd-last-modified-at: 2019-02-01T10:00:00Z" ]
+  [ "${lines[7]}" = "-->" ]
+}
+
+@test "mdd install-merge-driver, writes .gitattributes and git config" {
+  git init -q .
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd install-merge-driver
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = ".gitattributes" ]
+  [ "$(cat .gitattributes)" = ".mdd/documents/*.md merge=mdd" ]
+  [ "$(git config merge.mdd.driver)" = "mdd merge-driver %O %A %B" ]
+  run $BATS_CWD/mdd install-merge-driver
+  [ "$(cat .gitattributes)" = ".mdd/documents/*.md merge=mdd" ]
+}
+
+@test "mdd install-merge-driver, merges branches" {
+  export PATH=$BATS_CWD:$PATH
+  git init -q .
+  git config user.email "test@example.com"
+  git config user.name "test"
+  mdd init
+  req=$(basename $(mdd new req))
+  mdd install-merge-driver
+  git add -A && git commit -qm "base"
+  git checkout -qb other
+  mdd tag ${req} security
+  git commit -qam "other"
+  git checkout -q -
+  mdd tag ${req} login
+  git commit -qam "ours"
+  run git merge -q other -m "merge"
+  [ "$status" -eq 0 ]
+  grep -q "mdd-tag: login" ./.mdd/documents/${req}
+  grep -q "mdd-tag: security" ./.mdd/documents/${req}
+}
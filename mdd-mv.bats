@@ -0,0 +1,112 @@
+#!/usr/bin/env bats
+#
+# Test script for 'mdd mv' command
+#
+
+setup() {
+  rm -rf ./tmp/.mdd
+  rm -rf ./.mdd
+}
+
+@test "mdd mv, missing arguments" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  run $BATS_CWD/mdd mv ${req}
+  [ "$status" -eq 1 ]
+}
+
+@test "mdd mv, missing document" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd mv req-00-0001 req-00-0002
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Cant find document 'req-00-0001.md'" ]
+}
+
+@test "mdd mv, invalid filename" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  run $BATS_CWD/mdd mv ${req} login.md
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Document 'login.md' doesnt match mdd filename regex" ]
+}
+
+@test "mdd mv, existing document" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  att=$(basename $($BATS_CWD/mdd new att))
+  run $BATS_CWD/mdd mv ${req} ${att}
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Document '${att}' already exists" ]
+}
+
+@test "mdd mv, updates child and inline links" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  att_path=$($BATS_CWD/mdd new att)
+  att=$(basename ${att_path})
+  $BATS_CWD/mdd link -r verifies ${att} ${req}
+  echo "See [login](./${req}#happy-path)" >> ${att_path}
+  run $BATS_CWD/mdd mv ${req} req-00-0042
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "${req} -> req-00-0042.md" ]
+  [ -f ./.mdd/documents/req-00-0042.md ]
+  [ ! -f ./.mdd/documents/${req} ]
+  grep -q "mdd-child-verifies: req-00-0042.md" ${att_path}
+  grep -q "See \[login\](./req-00-0042.md#happy-path)" ${att_path}
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 0 ]
+}
+
+@test "mdd mv -t, moves to another template" {
+  $BATS_CWD/mdd init
+  nfr=$(basename $($BATS_CWD/mdd new nfr))
+  att=$(basename $($BATS_CWD/mdd new att))
+  $BATS_CWD/mdd link ${att} ${nfr}
+  run $BATS_CWD/mdd mv -t req ${nfr}
+  [ "$status" -eq 0 ]
+  req=req${nfr#nfr}
+  [ "${lines[0]}" = "${nfr} -> ${req}" ]
+  run $BATS_CWD/mdd ls --format csv
+  [ $(expr "$output" : ".*${req},Non Functional Requirement,req,") -ne 0 ]
+  [ $(expr "$output" : ".*${att},.*,${req}") -ne 0 ]
+}
+
+@test "mdd mv -t, unknown template" {
+  $BATS_CWD/mdd init
+  nfr=$(basename $($BATS_CWD/mdd new nfr))
+  run $BATS_CWD/mdd mv -t xyz ${nfr}
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Document 'xyz${nfr#nfr}' no template matching shortcode 'xyz'" ]
+}
+
+@test "mdd mv, updates doc-ref fields" {
+  $BATS_CWD/mdd init
+  printf "\n<!-- mdd-template\nmdd-field: supersedes doc-ref\n-->\n" >> ./.mdd/templates/adr.md
+  old=$(basename $($BATS_CWD/mdd new adr))
+  new_path=$($BATS_CWD/mdd new adr)
+  new=$(basename ${new_path})
+  $BATS_CWD/mdd set ${new} supersedes ${old}
+  run $BATS_CWD/mdd mv ${old} adr-zz-0009
+  [ "$status" -eq 0 ]
+  grep -q "^mdd-supersedes: adr-zz-0009.md$" ${new_path}
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 0 ]
+}
+
+@test "mdd mv -t, drops fields the template doesnt declare" {
+  $BATS_CWD/mdd init
+  printf "\n<!-- mdd-template\nmdd-field: priority enum(low,medium,high) default=medium\nmdd-field: owner string\n-->\n" >> ./.mdd/templates/req.md
+  printf "\n<!-- mdd-template\nmdd-field: owner string\n-->\n" >> ./.mdd/templates/nfr.md
+  req=$(basename $($BATS_CWD/mdd new req))
+  $BATS_CWD/mdd set ${req} owner sam
+  run $BATS_CWD/mdd mv -t nfr ${req}
+  [ "$status" -eq 0 ]
+  nfr=nfr${req#req}
+  [ "${lines[0]}" = "${req} -> ${nfr}" ]
+  [ "${lines[1]}" = "Dropped field 'priority' (medium) from '${nfr}', template 'nfr' doesnt declare it or the value isnt valid" ]
+  grep -q "^mdd-owner: sam$" ./.mdd/documents/${nfr}
+  run grep -c "^mdd-priority: " ./.mdd/documents/${nfr}
+  [ "${lines[0]}" = "0" ]
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 0 ]
+}
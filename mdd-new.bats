@@ -56,3 +56,58 @@ setup() {
   file_count=$( ls ./.mdd/documents/* | wc -l)
   [ $(expr "${file_count}" : "^ *100") -ne 0 ]
 }
+
+@test "mdd new, expands placeholders" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init -p my-project
+  new_file=$( $BATS_CWD/mdd new mtg 'Weekly sync')
+  id=$(basename ${new_file} .md)
+  run grep -c "^- Date: $(date +%Y-%m-%d)$" ${new_file}
+  [ "$output" = "1" ]
+  run grep -c "^- Reference: ${id}$" ${new_file}
+  [ "$output" = "1" ]
+  printf "Title {{.Title}}, project {{.Project}}, file {{.Filename}}\n" >> ./.mdd/templates/adr.md
+  new_file=$( $BATS_CWD/mdd new adr 'Use Go')
+  run grep -c "^Title Use Go, project my-project, file $(basename ${new_file})$" ${new_file}
+  [ "$output" = "1" ]
+}
+
+@test "mdd new, placeholders in the metadata" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init -p my-project
+  printf "\n<!-- mdd\nmdd-tag: {{.Project}}\n-->\n" >> ./.mdd/templates/req.md
+  new_file=$( $BATS_CWD/mdd new req 'Login')
+  run $BATS_CWD/mdd ls -l
+  [ "$status" -eq 0 ]
+  run grep -c "^mdd-status: draft$" ${new_file}
+  [ "$output" = "1" ]
+  run tail -2 ${new_file}
+  [ "${lines[0]}" = "mdd-tag: my-project" ]
+  [ "${lines[1]}" = "-->" ]
+}
+
+@test "mdd new, leaves other braces alone" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  printf "{{.Nope}} {{ range .Items }} {{ .Title }}\n" >> ./.mdd/templates/req.md
+  run $BATS_CWD/mdd templates
+  [ "${lines[5]}" = "   req: Functional Requirement" ]
+  new_file=$( $BATS_CWD/mdd new req 'Login')
+  run grep -c "^{{.Nope}} {{ range .Items }} Login$" ${new_file}
+  [ "$output" = "1" ]
+}
+
+@test "mdd new, records author and creation time" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  new_file=$( $BATS_CWD/mdd new adr)
+  run grep -c "^mdd-date-time: $(date +%Y-%m-%d)T" ${new_file}
+  [ "$output" = "1" ]
+  author=$(git config user.name || true)
+  if [ -n "${author}" ]; then
+    run grep -c "^mdd-author: ${author}$" ${new_file}
+  else
+    run grep -c "^mdd-author: ." ${new_file}
+  fi
+  [ "$output" = "1" ]
+}
@@ -0,0 +1,54 @@
+#!/usr/bin/env bats
+#
+# Test script for 'mdd parents' command
+#
+
+setup() {
+  rm -rf ./tmp/.mdd
+  rm -rf ./.mdd
+}
+
+@test "mdd parents, missing arguments" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd parents
+  [ "$status" -eq 1 ]
+}
+
+@test "mdd parents, missing document" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd parents req-00-0001
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Cant find document 'req-00-0001.md'" ]
+}
+
+@test "mdd parents, no parents" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  run $BATS_CWD/mdd parents ${req}
+  [ "$status" -eq 0 ]
+  [ "$output" = "" ]
+}
+
+@test "mdd parents, lists every parent" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  att=$(basename $($BATS_CWD/mdd new att))
+  itst=$(basename $($BATS_CWD/mdd new itst))
+  $BATS_CWD/mdd link -r verifies ${att} ${req}
+  $BATS_CWD/mdd link ${itst} ${req}
+  run $BATS_CWD/mdd parents ${req%.md}
+  [ "$status" -eq 0 ]
+  [ ${#lines[@]} -eq 2 ]
+  [ $(expr "${lines[0]}" : "^${att}.*(verifies)$") -ne 0 ]
+  [ $(expr "${lines[1]}" : "^${itst}") -ne 0 ]
+}
+
+@test "mdd parents, children are not parents" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  att=$(basename $($BATS_CWD/mdd new att))
+  $BATS_CWD/mdd link ${att} ${req}
+  run $BATS_CWD/mdd parents ${att}
+  [ "$status" -eq 0 ]
+  [ "$output" = "" ]
+}
@@ -33,3 +33,150 @@ setup() {
   [ "$status" -eq 0 ]
 }
 
+
+@test "mdd publish, index shows parents" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  att=$(basename $($BATS_CWD/mdd new att))
+  $BATS_CWD/mdd link -r verifies ${att} ${req}
+  run $BATS_CWD/mdd publish
+  [ "$status" -eq 0 ]
+  run grep -c "&larr; <a href='${att%.md}.html'>${att}</a> : Automated test <em>(verifies)</em>" ./.mdd/publish/index.html
+  [ "$output" = "1" ]
+}
+
+@test "mdd publish, document page has navigation and links" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  att=$(basename $($BATS_CWD/mdd new att))
+  $BATS_CWD/mdd link -r verifies ${att} ${req}
+  $BATS_CWD/mdd tag ${req} security
+  run $BATS_CWD/mdd publish
+  [ "$status" -eq 0 ]
+  page=./.mdd/publish/${req%.md}.html
+  grep -q "<title>Functional Requirement</title>" ${page}
+  grep -q "<a href='index.html'>Project Summary</a> &rsaquo; Functional Requirement &rsaquo; ${req}" ${page}
+  grep -q "#security" ${page}
+  grep -q "<br>created $(date +%Y-%m-%d) .* by .*, modified $(date +%Y-%m-%d) .* by " ${page}
+  grep -q "<a href='${att%.md}.html'>${att}</a> : Automated test <em>(verifies)</em>" ${page}
+  grep -q "<em>verifies</em> <a href='${req%.md}.html'>${req}</a>" ./.mdd/publish/${att%.md}.html
+}
+
+@test "mdd publish, rewrites inline links to documents" {
+  $BATS_CWD/mdd init
+  doc_path=$($BATS_CWD/mdd new att)
+  req=$(basename $($BATS_CWD/mdd new req))
+  echo "See [login](${req}#happy-path) and [missing](req-00-0009.md)" >> ${doc_path}
+  run $BATS_CWD/mdd publish
+  [ "$status" -eq 0 ]
+  page=./.mdd/publish/$(basename ${doc_path} .md).html
+  grep -q "<a href=\"${req%.md}.html#happy-path\"" ${page}
+  grep -q "<a href=\"req-00-0009.md\"" ${page}
+}
+
+@test "mdd publish, uses the project document template" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  $BATS_CWD/mdd publish
+  echo "<p>Custom {{ .Doc.Title }}</p>" > ./.mdd/templates/document.html
+  run $BATS_CWD/mdd publish
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "Published 1 documents, 0 unchanged, 0 removed" ]
+  run cat ./.mdd/publish/${req%.md}.html
+  [ "$output" = "<p>Custom Functional Requirement</p>" ]
+}
+
+@test "mdd publish, writes search index" {
+  $BATS_CWD/mdd init
+  file=$(basename $($BATS_CWD/mdd new req "User login"))
+  $BATS_CWD/mdd tag ${file} security
+  run $BATS_CWD/mdd publish
+  [ "$status" -eq 0 ]
+  run grep -c "search.json" ./.mdd/publish/index.html
+  [ "$status" -eq 0 ]
+  run grep -o "\"filename\":\"${file}\",\"title\":\"User login\",\"template\":\"req\",\"status\":\"draft\",\"tags\":\[\"security\"\]" ./.mdd/publish/search.json
+  [ "$status" -eq 0 ]
+}
+
+@test "mdd publish, twice only converts changed documents" {
+  $BATS_CWD/mdd init
+  parent_path=$($BATS_CWD/mdd new att)
+  parent=$(basename ${parent_path})
+  child_path=$($BATS_CWD/mdd new req "User login")
+  child=$(basename ${child_path})
+  other=$(basename $($BATS_CWD/mdd new adr))
+  $BATS_CWD/mdd link ${parent} ${child}
+  run $BATS_CWD/mdd publish
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "Published 3 documents, 0 unchanged, 0 removed" ]
+  run $BATS_CWD/mdd publish
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "Published 0 documents, 3 unchanged, 0 removed" ]
+
+  # Changing a title also converts the documents linking to it
+  sed -i.bak 's/^# User login$/# User logon/' ${child_path}
+  rm ${child_path}.bak
+  run $BATS_CWD/mdd publish
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "Published 2 documents, 1 unchanged, 0 removed" ]
+}
+
+@test "mdd publish, converts documents whose doc-ref fields change" {
+  $BATS_CWD/mdd init
+  printf "\n<!-- mdd-template\nmdd-field: supersedes doc-ref\n-->\n" >> ./.mdd/templates/adr.md
+  old_path=$($BATS_CWD/mdd new adr "Use MySQL")
+  old=$(basename ${old_path})
+  new=$(basename $($BATS_CWD/mdd new adr "Use Postgres"))
+  $BATS_CWD/mdd set ${new} supersedes ${old}
+  run $BATS_CWD/mdd publish
+  [ "${lines[0]}" = "Published 2 documents, 0 unchanged, 0 removed" ]
+
+  # Changing the title of the document referred to
+  sed -i.bak 's/^# Use MySQL$/# Use MariaDB/' ${old_path}
+  rm ${old_path}.bak
+  run $BATS_CWD/mdd publish
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "Published 2 documents, 0 unchanged, 0 removed" ]
+  grep -q "Use MariaDB" ./.mdd/publish/$(basename ${new} .md).html
+
+  # Deleting the document referred to
+  rm ${old_path}
+  run $BATS_CWD/mdd publish
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "Published 1 documents, 0 unchanged, 1 removed" ]
+}
+
+@test "mdd publish, removes deleted documents" {
+  $BATS_CWD/mdd init
+  file_path=$($BATS_CWD/mdd new adr)
+  file=$(basename ${file_path})
+  $BATS_CWD/mdd publish
+  run ls ./.mdd/publish/$(basename ${file_path} .md).html
+  [ "$status" -eq 0 ]
+  $BATS_CWD/mdd rm ${file}
+  run $BATS_CWD/mdd publish
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "Published 0 documents, 0 unchanged, 1 removed" ]
+  run ls ./.mdd/publish/$(basename ${file_path} .md).html
+  [ "$status" -ne 0 ]
+}
+
+@test "mdd publish -f, rebuilds everything" {
+  $BATS_CWD/mdd init
+  $BATS_CWD/mdd new adr
+  $BATS_CWD/mdd publish
+  run $BATS_CWD/mdd publish -f
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "Published 1 documents, 0 unchanged, 0 removed" ]
+}
+
+@test "mdd publish -f, leaves files it didnt write" {
+  $BATS_CWD/mdd init
+  $BATS_CWD/mdd new adr
+  $BATS_CWD/mdd publish
+  echo "keep" > ./.mdd/publish/notes.txt
+  run $BATS_CWD/mdd publish -f
+  [ "$status" -eq 0 ]
+  [ -f ./.mdd/publish/notes.txt ]
+  [ -f ./.mdd/publish/index.html ]
+}
@@ -0,0 +1,50 @@
+#!/usr/bin/env bats
+#
+# Test script for 'mdd renumber' command
+#
+
+setup() {
+  rm -rf ./tmp/.mdd
+  rm -rf ./.mdd
+}
+
+@test "mdd renumber, missing project" {
+  run $BATS_CWD/mdd renumber
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "No project found" ]
+}
+
+@test "mdd renumber, nothing to do" {
+  $BATS_CWD/mdd init
+  $BATS_CWD/mdd new req
+  $BATS_CWD/mdd new att
+  run $BATS_CWD/mdd renumber
+  [ "$status" -eq 0 ]
+  [ "$output" = "" ]
+}
+
+@test "mdd renumber, removes clashes and gaps" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  att=$(basename $($BATS_CWD/mdd new att))
+  $BATS_CWD/mdd link ${att} ${req}
+  $BATS_CWD/mdd mv ${req} req-aa-0007
+  $BATS_CWD/mdd mv ${att} att-bb-0007
+  run $BATS_CWD/mdd renumber
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "att-bb-0007.md -> att-bb-0001.md" ]
+  [ "${lines[1]}" = "req-aa-0007.md -> req-aa-0002.md" ]
+  grep -q "mdd-child: req-aa-0002.md" ./.mdd/documents/att-bb-0001.md
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 0 ]
+}
+
+@test "mdd renumber -n, changes nothing" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  $BATS_CWD/mdd mv ${req} req-aa-0007
+  run $BATS_CWD/mdd renumber -n
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "req-aa-0007.md -> req-aa-0001.md" ]
+  [ -f ./.mdd/documents/req-aa-0007.md ]
+}
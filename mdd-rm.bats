@@ -96,4 +96,19 @@ setup() {
   run $BATS_CWD/mdd ls
   [ "$status" -eq 0 ]
   [ "${lines[0]}" = "" ]
-}
\ No newline at end of file
+}
+@test "mdd rm, clears doc-ref fields" {
+  $BATS_CWD/mdd init
+  printf "\n<!-- mdd-template\nmdd-field: supersedes doc-ref\n-->\n" >> ./.mdd/templates/adr.md
+  old=$(basename $($BATS_CWD/mdd new adr))
+  new_path=$($BATS_CWD/mdd new adr)
+  new=$(basename ${new_path})
+  $BATS_CWD/mdd set ${new} supersedes ${old}
+  run $BATS_CWD/mdd rm ${old}
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "Cleared field 'supersedes' of '${new}', it referred to '${old}'" ]
+  run grep -c "^mdd-supersedes: " ${new_path}
+  [ "${lines[0]}" = "0" ]
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 0 ]
+}
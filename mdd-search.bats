@@ -0,0 +1,108 @@
+#!/usr/bin/env bats
+#
+# Test script for 'mdd search' command
+#
+
+setup() {
+  rm -rf ./tmp/.mdd
+  rm -rf ./.mdd
+}
+
+@test "mdd search, missing query" {
+  run $BATS_CWD/mdd search
+  [ "$status" -eq 1 ]
+}
+
+@test "mdd search, missing project" {
+  run $BATS_CWD/mdd search login
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "No project found" ]
+}
+
+@test "mdd search, no matches" {
+  $BATS_CWD/mdd init
+  $BATS_CWD/mdd new req "User login"
+  run $BATS_CWD/mdd search xyzzy
+  [ "$status" -eq 0 ]
+  [ "${#lines[@]}" -eq 0 ]
+}
+
+@test "mdd search, title matches rank first" {
+  $BATS_CWD/mdd init
+  adr=$(basename $($BATS_CWD/mdd new adr "Framework choice"))
+  req=$(basename $($BATS_CWD/mdd new req "User login"))
+  run $BATS_CWD/mdd search login
+  [ "$status" -eq 0 ]
+  [ $(expr "${lines[0]}" : "^${req}.*User login") -ne 0 ]
+  [ $(expr "${lines[1]}" : ".*\*\*login\*\*") -ne 0 ]
+}
+
+@test "mdd search, snippet with multi-byte lower case" {
+  $BATS_CWD/mdd init
+  req=$($BATS_CWD/mdd new req "User login")
+  echo "ȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺȺ zebra crossing" >> ${req}
+  run $BATS_CWD/mdd search zebra
+  [ "$status" -eq 0 ]
+  [ $(expr "${lines[1]}" : ".*Ⱥ \*\*zebra\*\* crossing") -ne 0 ]
+}
+
+@test "mdd search, every term must match" {
+  $BATS_CWD/mdd init
+  $BATS_CWD/mdd new adr "Framework choice"
+  req=$(basename $($BATS_CWD/mdd new req "User login"))
+  run $BATS_CWD/mdd search login password
+  [ "$status" -eq 0 ]
+  [ $(expr "${lines[0]}" : "^${req}") -ne 0 ]
+  [ "${#lines[@]}" -eq 2 ]
+}
+
+@test "mdd search, phrase" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req "User login"))
+  run $BATS_CWD/mdd search '"password field"'
+  [ "$status" -eq 0 ]
+  [ $(expr "${lines[0]}" : "^${req}") -ne 0 ]
+  run $BATS_CWD/mdd search '"field password"'
+  [ "$status" -eq 0 ]
+  [ "${#lines[@]}" -eq 0 ]
+}
+
+@test "mdd search, unterminated phrase" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd search '"user login'
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Unterminated phrase in query '\"user login'" ]
+}
+
+@test "mdd search, filters" {
+  $BATS_CWD/mdd init
+  adr1=$(basename $($BATS_CWD/mdd new adr "Login framework"))
+  adr2=$(basename $($BATS_CWD/mdd new adr "Login storage"))
+  req=$(basename $($BATS_CWD/mdd new req "User login"))
+  $BATS_CWD/mdd tag ${adr1} security
+  $BATS_CWD/mdd tag ${req} security
+  $BATS_CWD/mdd status ${adr1} proposed
+  run $BATS_CWD/mdd search login tag:security template:adr
+  [ "$status" -eq 0 ]
+  [ $(expr "${lines[0]}" : "^${adr1}") -ne 0 ]
+  [ "${#lines[@]}" -eq 2 ]
+  run $BATS_CWD/mdd search status:proposed
+  [ "$status" -eq 0 ]
+  [ $(expr "${lines[0]}" : "^${adr1}") -ne 0 ]
+  [ "${#lines[@]}" -eq 1 ]
+}
+
+@test "mdd search -where" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req "User login"))
+  att=$(basename $($BATS_CWD/mdd new att "Login test"))
+  $BATS_CWD/mdd link ${req} ${att}
+  run $BATS_CWD/mdd search -where 'linked-from(template=req)' login
+  [ "$status" -eq 0 ]
+  [ $(expr "${lines[0]}" : "^${att}.*Login test") -ne 0 ]
+  [ "${#lines[@]}" -eq 2 ]
+  run $BATS_CWD/mdd search -where 'template=req'
+  [ "$status" -eq 0 ]
+  [ "${#lines[@]}" -eq 1 ]
+  [ $(expr "${lines[0]}" : "^${req}") -ne 0 ]
+}
@@ -0,0 +1,46 @@
+#!/usr/bin/env bats
+#
+# Test script for 'mdd serve' command
+#
+
+setup() {
+  rm -rf ./tmp/.mdd
+  rm -rf ./.mdd
+}
+
+teardown() {
+  if [ -n "${pid}" ]; then
+    kill ${pid}
+  fi
+}
+
+@test "mdd serve, missing project" {
+  run $BATS_CWD/mdd serve
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "No project found" ]
+}
+
+@test "mdd serve, renders index and documents" {
+  $BATS_CWD/mdd init
+  file=$(basename $($BATS_CWD/mdd new req "User login"))
+  $BATS_CWD/mdd serve -addr localhost:8765 &
+  pid=$!
+  sleep 1
+  run curl -s http://localhost:8765/
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "<h1>Project Summary</h1>" ]
+  run curl -s http://localhost:8765/${file%.md}.html
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "<!DOCTYPE html>" ]
+  [ $(expr "$output" : ".*<h1>User login</h1>") -ne 0 ]
+  [ $(expr "$output" : ".*</script>.*</body>") -ne 0 ]
+}
+
+@test "mdd serve, unknown document" {
+  $BATS_CWD/mdd init
+  $BATS_CWD/mdd serve -addr localhost:8765 &
+  pid=$!
+  sleep 1
+  run curl -s -o /dev/null -w "%{http_code}" http://localhost:8765/req-b7-0001.html
+  [ "${output}" = "404" ]
+}
@@ -0,0 +1,115 @@
+#!/usr/bin/env bats
+#
+# Test script for 'mdd set' command
+#
+
+setup() {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  printf "\n<!-- mdd-template\nmdd-field: priority enum(low,medium,high) required default=medium\nmdd-field: effort int\nmdd-field: due date\nmdd-field: owner string required\nmdd-field: design doc-ref\n-->\n" >> ./.mdd/templates/req.md
+}
+
+teardown() {
+  rm -rf ./.mdd
+}
+
+@test "mdd set, missing arguments" {
+  run $BATS_CWD/mdd set
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Cannot parse command line. Try 'mdd help set'" ]
+}
+
+@test "mdd set, missing document" {
+  run $BATS_CWD/mdd set req-00-0001 owner Sue
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Cant find document 'req-00-0001.md'" ]
+}
+
+@test "mdd set, new document has defaults" {
+  req=$($BATS_CWD/mdd new req)
+  run tail -2 ${req}
+  [ "${lines[0]}" = "mdd-priority: medium" ]
+  [ "${lines[1]}" = "-->" ]
+}
+
+@test "mdd set, valid values" {
+  req=$(basename $($BATS_CWD/mdd new req))
+  adr=$(basename $($BATS_CWD/mdd new adr))
+  run $BATS_CWD/mdd set ${req} priority high
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "${req} priority -> high" ]
+  $BATS_CWD/mdd set ${req} effort 3
+  $BATS_CWD/mdd set ${req} due 2019-06-30
+  $BATS_CWD/mdd set ${req} owner "Sue Smith"
+  run $BATS_CWD/mdd set ${req} design $(basename ${adr} .md)
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "${req} design -> ${adr}" ]
+  run tail -6 ./.mdd/documents/${req}
+  [ "${lines[0]}" = "mdd-priority: high" ]
+  [ "${lines[1]}" = "mdd-effort: 3" ]
+  [ "${lines[2]}" = "mdd-due: 2019-06-30" ]
+  [ "${lines[3]}" = "mdd-owner: Sue Smith" ]
+  [ "${lines[4]}" = "mdd-design: ${adr}" ]
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 0 ]
+}
+
+@test "mdd set, invalid values" {
+  req=$(basename $($BATS_CWD/mdd new req))
+  run $BATS_CWD/mdd set ${req} priority urgent
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Invalid enum field 'priority', 'urgent' is not one of: low, medium, high" ]
+  run $BATS_CWD/mdd set ${req} effort lots
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Invalid int field 'effort', 'lots' is not an int" ]
+  run $BATS_CWD/mdd set ${req} due 30/06/2019
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Invalid date field 'due', '30/06/2019' is not a date, expected YYYY-MM-DD" ]
+  run $BATS_CWD/mdd set ${req} design adr-00-0001
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Invalid doc-ref field 'design', 'adr-00-0001.md' doesnt exist" ]
+}
+
+@test "mdd set, unknown field" {
+  req=$(basename $($BATS_CWD/mdd new req))
+  adr=$(basename $($BATS_CWD/mdd new adr))
+  run $BATS_CWD/mdd set ${req} colour blue
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Template 'req' has no field 'colour', expected one of: priority, effort, due, owner, design" ]
+  run $BATS_CWD/mdd set ${adr} colour blue
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Template 'adr' has no fields" ]
+}
+
+@test "mdd set, verify checks fields" {
+  req=$(basename $($BATS_CWD/mdd new req))
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Document '${req}' missing required field 'owner'" ]
+  $BATS_CWD/mdd set ${req} owner Sue
+  sed -i.bak "s/mdd-priority: medium/mdd-priority: urgent/" ./.mdd/documents/${req}
+  rm ./.mdd/documents/${req}.bak
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Document '${req}' field 'priority' is invalid, 'urgent' is not one of: low, medium, high" ]
+}
+
+@test "mdd set, invalid template field" {
+  printf "\n<!-- mdd-template\nmdd-field: risk enum()\n-->\n" >> ./.mdd/templates/adr.md
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Template '.mdd/templates/adr.md' field 'risk' enum has no values" ]
+}
+
+@test "mdd set, published page shows fields" {
+  req=$(basename $($BATS_CWD/mdd new req))
+  adr=$(basename $($BATS_CWD/mdd new adr "Framework"))
+  $BATS_CWD/mdd set ${req} owner Sue
+  $BATS_CWD/mdd set ${req} design ${adr}
+  $BATS_CWD/mdd publish
+  html=./.mdd/publish/$(basename ${req} .md).html
+  run grep -c "owner: Sue" ${html}
+  [ "$output" = "1" ]
+  run grep -c "design: <a href='$(basename ${adr} .md).html'>${adr}</a> : Framework" ${html}
+  [ "$output" = "1" ]
+}
@@ -0,0 +1,107 @@
+#!/usr/bin/env bats
+#
+# Test script for 'mdd status' command
+#
+
+setup() {
+  rm -rf ./tmp/.mdd
+  rm -rf ./.mdd
+}
+
+@test "mdd status missing args" {
+  run $BATS_CWD/mdd status
+  [ "$status" -eq 1 ]
+}
+
+@test "mdd status, missing project" {
+  run $BATS_CWD/mdd status doc
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "No project found" ]
+}
+
+@test "mdd status, missing document" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd status doc accepted
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Cant find document 'doc.md'" ]
+}
+
+@test "mdd status, new documents are drafts" {
+  $BATS_CWD/mdd init
+  file_path=$($BATS_CWD/mdd new req)
+  run $BATS_CWD/mdd status $(basename ${file_path})
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "draft" ]
+  run grep "mdd-status: draft" ${file_path}
+  [ "$status" -eq 0 ]
+}
+
+@test "mdd status, unknown status" {
+  $BATS_CWD/mdd init
+  doc=$(basename $($BATS_CWD/mdd new req))
+  run $BATS_CWD/mdd status ${doc} done
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Unknown status 'done', expected one of: draft, proposed, accepted, deprecated, superseded" ]
+}
+
+@test "mdd status, template without transitions allows any change" {
+  $BATS_CWD/mdd init
+  file_path=$($BATS_CWD/mdd new req)
+  doc=$(basename ${file_path})
+  run $BATS_CWD/mdd status ${doc} accepted
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "${doc} draft -> accepted" ]
+  run grep "mdd-status: accepted" ${file_path}
+  [ "$status" -eq 0 ]
+}
+
+@test "mdd status, template transitions are enforced" {
+  $BATS_CWD/mdd init
+  doc=$(basename $($BATS_CWD/mdd new adr))
+  run $BATS_CWD/mdd status ${doc} accepted
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Document '${doc}' cant move from 'draft' to 'accepted', expected one of: proposed" ]
+  run $BATS_CWD/mdd status ${doc} proposed
+  [ "$status" -eq 0 ]
+  run $BATS_CWD/mdd status ${doc} accepted
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "${doc} proposed -> accepted" ]
+}
+
+@test "mdd status, invalid status in document" {
+  $BATS_CWD/mdd init
+  file_path=$($BATS_CWD/mdd new adr)
+  doc=$(basename ${file_path})
+  sed -i.bak 's/mdd-status: draft/mdd-status: done/' ${file_path}
+  rm ${file_path}.bak
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Document '${doc}' unknown status 'done'" ]
+}
+
+@test "mdd ls -status filters documents" {
+  $BATS_CWD/mdd init
+  draft=$(basename $($BATS_CWD/mdd new req))
+  accepted=$(basename $($BATS_CWD/mdd new req))
+  $BATS_CWD/mdd status ${accepted} accepted
+  run $BATS_CWD/mdd ls -status accepted
+  [ "$status" -eq 0 ]
+  [ "${#lines[@]}" -eq 1 ]
+  [ $(expr "${lines[0]}" : "^${accepted}.*accepted") -ne 0 ]
+}
+
+@test "mdd status -where" {
+  $BATS_CWD/mdd init
+  req1=$(basename $($BATS_CWD/mdd new req))
+  req2=$(basename $($BATS_CWD/mdd new req))
+  adr=$(basename $($BATS_CWD/mdd new adr))
+  run $BATS_CWD/mdd status -where 'template=req' proposed
+  [ "$status" -eq 0 ]
+  [ "${#lines[@]}" -eq 2 ]
+  [ "${lines[0]}" = "${req1} draft -> proposed" ]
+  [ "${lines[1]}" = "${req2} draft -> proposed" ]
+  run $BATS_CWD/mdd status -where 'status=proposed'
+  [ "$status" -eq 0 ]
+  [ "${#lines[@]}" -eq 2 ]
+  [ $(expr "${lines[0]}" : "^${req1} *proposed") -ne 0 ]
+}
@@ -78,6 +78,18 @@ setup() {
   [ "$status" -eq 0 ]
 }
 
+@test "mdd tag, records last modified" {
+  $BATS_CWD/mdd init
+  file_path=$($BATS_CWD/mdd new adr)
+  run grep "mdd-last-modified-at:" ${file_path}
+  [ "$status" -eq 1 ]
+  $BATS_CWD/mdd tag $(basename ${file_path}) tag-1
+  run grep -c "^mdd-last-modified-at: $(date +%Y-%m-%d)T" ${file_path}
+  [ "$output" = "1" ]
+  run grep -c "^mdd-last-modified-by: ." ${file_path}
+  [ "$output" = "1" ]
+}
+
 @test "mdd tag, many tags" {
   $BATS_CWD/mdd init
   file_path=$($BATS_CWD/mdd new adr)
@@ -91,4 +103,26 @@ setup() {
     run grep "mdd-tag: tag-${suffix}" ${file_path}
     [ "$status" -eq 0 ]
   done
-}
\ No newline at end of file
+}
+
+@test "mdd tag -where" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  adr=$(basename $($BATS_CWD/mdd new adr))
+  run $BATS_CWD/mdd tag -where 'template=req' security web
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "${req}" ]
+  [ "${#lines[@]}" -eq 1 ]
+  run $BATS_CWD/mdd ls -1 -where 'tag=security and tag=web'
+  [ "${lines[0]}" = "${req}" ]
+  [ "${#lines[@]}" -eq 1 ]
+  # Documents already tagged arent changed
+  run $BATS_CWD/mdd tag -where 'template=req' security
+  [ "$status" -eq 0 ]
+  [ "${#lines[@]}" -eq 0 ]
+  run $BATS_CWD/mdd untag -where 'tag=web' web
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "${req}" ]
+  run $BATS_CWD/mdd ls -1 -where 'tag=web'
+  [ "${#lines[@]}" -eq 0 ]
+}
@@ -21,3 +21,174 @@
   [ "${lines[4]}" = "   nfr: Non Functional Requirement" ]
   [ "${lines[5]}" = "   req: Functional Requirement" ]
 }
+
+@test "mdd templates --format yaml" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd templates --format yaml
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "- shortcut: adr" ]
+  [ "${lines[1]}" = "  title: Architecture Decision Record" ]
+}
+
+@test "mdd templates, unknown format" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd templates --format xml
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Unknown format 'xml', expected one of: text, json, yaml, csv" ]
+}
+
+@test "mdd templates add" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd templates add risk Risk register
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = ".mdd/templates/risk.md" ]
+  run $BATS_CWD/mdd templates
+  [ "${lines[6]}" = "  risk: Risk register" ]
+  run $BATS_CWD/mdd new risk "Supplier fails"
+  [ "$status" -eq 0 ]
+  [ $(expr "${lines[0]}" : ".mdd/documents/risk-.*-0001.md") -ne 0 ]
+}
+
+@test "mdd templates add, invalid" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd templates add req
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Template 'req' already exists" ]
+  run $BATS_CWD/mdd templates add Risk-1
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Invalid template shortcut 'Risk-1', expected lower case letters and digits" ]
+  run $BATS_CWD/mdd templates add risk "Risk #1"
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Invalid template title 'Risk #1', expected letters, digits, spaces and '-.~'" ]
+  run $BATS_CWD/mdd templates add
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Missing 'shortcut' argument" ]
+}
+
+@test "mdd templates rm" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd templates rm nfr
+  [ "$status" -eq 0 ]
+  [ ! -f ./.mdd/templates/nfr.md ]
+  run grep "nfr.md" ./.mdd/config.yaml
+  [ "$status" -eq 1 ]
+  run $BATS_CWD/mdd templates rm nfr
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "No such template: 'nfr'" ]
+}
+
+@test "mdd templates rm, template in use" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  adr=$(basename $($BATS_CWD/mdd new adr))
+  run $BATS_CWD/mdd templates rm adr
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Template 'adr' is used by: ${adr}" ]
+  [ -f ./.mdd/templates/adr.md ]
+}
+
+@test "mdd templates show" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd templates show mtg
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "# Meeting" ]
+  run $BATS_CWD/mdd templates show document.html
+  [ "$status" -eq 0 ]
+  run $BATS_CWD/mdd templates show xyz
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "No such template: 'xyz'" ]
+}
+
+@test "mdd templates diff" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd templates diff
+  [ "$status" -eq 0 ]
+  [ "${#lines[@]}" -eq 0 ]
+  sed -i.bak 's/^# Meeting$/# Team meeting/' ./.mdd/templates/mtg.md
+  run $BATS_CWD/mdd templates diff
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "--- built-in/mtg.md" ]
+  [ "${lines[1]}" = "+++ .mdd/templates/mtg.md" ]
+  [ "${lines[2]}" = "@@ -1,4 +1,4 @@" ]
+  [ "${lines[3]}" = "-# Meeting" ]
+  [ "${lines[4]}" = "+# Team meeting" ]
+  run $BATS_CWD/mdd templates diff foo
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Template 'foo' isnt built into mdd" ]
+}
+
+# Makes the recorded base of req.md an older built-in version, without the
+# 'Current' line
+old_req_base() {
+  sed -i.bak '/^- Current:/d' ./.mdd/templates-base/req.md
+  hash=$(sha256sum ./.mdd/templates-base/req.md | cut -d ' ' -f 1)
+  sed -i.bak "s/^  req.md: .*/  req.md: ${hash}/" ./.mdd/config.yaml
+}
+
+@test "mdd templates upgrade" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd templates upgrade req
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "req.md          up to date" ]
+  old_req_base
+  sed -i.bak '/^- Current:/d' ./.mdd/templates/req.md
+  run $BATS_CWD/mdd templates upgrade
+  [ "$status" -eq 0 ]
+  [ "${lines[8]}" = "req.md          upgraded" ]
+  run $BATS_CWD/mdd templates diff req
+  [ "${#lines[@]}" -eq 0 ]
+}
+
+@test "mdd templates upgrade, merges local changes" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  old_req_base
+  sed -i.bak -e '/^- Current:/d' -e 's/^# Functional Requirement$/# Functional Requirement Spec/' ./.mdd/templates/req.md
+  run $BATS_CWD/mdd templates upgrade req
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "req.md          merged" ]
+  run grep -c -e "^- Current:" -e "^# Functional Requirement Spec$" ./.mdd/templates/req.md
+  [ "${lines[0]}" = "2" ]
+  run $BATS_CWD/mdd templates upgrade req
+  [ "${lines[0]}" = "req.md          up to date" ]
+}
+
+@test "mdd templates upgrade, conflict" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  old_req_base
+  sed -i.bak 's/^- Current:.*/- Current: Up to date./' ./.mdd/templates/req.md
+  sed -i.bak 's/^- Current:.*/- Current: Up to date./' ./.mdd/templates-base/req.md
+  hash=$(sha256sum ./.mdd/templates-base/req.md | cut -d ' ' -f 1)
+  sed -i.bak "s/^  req.md: .*/  req.md: ${hash}/" ./.mdd/config.yaml
+  sed -i.bak 's/^- Current:.*/- Current: Still true./' ./.mdd/templates/req.md
+  run $BATS_CWD/mdd templates upgrade req
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "req.md          merged with 1 conflicts, fix the lines between '<<<<<<<' and '>>>>>>>'" ]
+  run grep -c "^<<<<<<< ours" ./.mdd/templates/req.md
+  [ "${lines[0]}" = "1" ]
+}
+
+@test "mdd templates upgrade, no recorded base" {
+  rm -rf ./.mdd
+  $BATS_CWD/mdd init
+  sed -i.bak '/^templates:/,$d' ./.mdd/config.yaml
+  echo "Local change" >> ./.mdd/templates/req.md
+  run $BATS_CWD/mdd templates upgrade
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "adr.md          up to date" ]
+  [ "${lines[8]}" = "req.md          has local changes and no recorded base version, skipped, use -f to replace it" ]
+  run $BATS_CWD/mdd templates upgrade -f req
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "req.md          replaced" ]
+  run grep "Local change" ./.mdd/templates/req.md
+  [ "$status" -eq 1 ]
+}
@@ -0,0 +1,83 @@
+#!/usr/bin/env bats
+#
+# Test script for 'mdd trace' command
+#
+
+setup() {
+  rm -rf ./tmp/.mdd
+  rm -rf ./.mdd
+}
+
+@test "mdd trace, missing project" {
+  run $BATS_CWD/mdd trace
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "No project found" ]
+}
+
+@test "mdd trace, empty project has full coverage" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd trace
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "Coverage: 0/0 (100%)" ]
+}
+
+@test "mdd trace, direct link" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  att=$(basename $($BATS_CWD/mdd new att))
+  $BATS_CWD/mdd link -r verifies ${att} ${req}
+  run $BATS_CWD/mdd trace
+  [ "$status" -eq 0 ]
+  [ $(expr "${lines[0]}" : ".*${att}") -ne 0 ]
+  [ $(expr "${lines[1]}" : "^${req}.*X$") -ne 0 ]
+  [ "${lines[2]}" = "Coverage: 1/1 (100%)" ]
+}
+
+@test "mdd trace, transitive link" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  adr=$(basename $($BATS_CWD/mdd new adr))
+  itst=$(basename $($BATS_CWD/mdd new itst))
+  $BATS_CWD/mdd link ${req} ${adr}
+  $BATS_CWD/mdd link ${adr} ${itst}
+  run $BATS_CWD/mdd trace
+  [ "$status" -eq 0 ]
+  [ $(expr "${lines[1]}" : "^${req}.*X$") -ne 0 ]
+}
+
+@test "mdd trace, uncovered requirement" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  nfr=$(basename $($BATS_CWD/mdd new nfr))
+  att=$(basename $($BATS_CWD/mdd new att))
+  $BATS_CWD/mdd link ${req} ${att}
+  run $BATS_CWD/mdd trace
+  [ "$status" -eq 0 ]
+  [ "${lines[3]}" = "Coverage: 1/2 (50%)" ]
+}
+
+@test "mdd trace -format csv" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req "Login"))
+  att=$(basename $($BATS_CWD/mdd new att))
+  $BATS_CWD/mdd link ${req} ${att}
+  run $BATS_CWD/mdd trace -format csv
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "document,title,${att}" ]
+  [ "${lines[1]}" = "${req},Login,X" ]
+}
+
+@test "mdd trace -format html" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd trace -format html
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = ".mdd/publish/trace.html" ]
+  [ -f ./.mdd/publish/trace.html ]
+}
+
+@test "mdd trace, unknown format" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd trace -format pdf
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Unknown format 'pdf', expected one of: text, csv, html" ]
+}
@@ -20,12 +20,12 @@ setup() {
   [ "$status" -eq 0 ]
 }
 
-@test "mdd verify, remove project.data file" {
+@test "mdd verify, remove config.yaml file" {
   $BATS_CWD/mdd init
-  rm ./.mdd/project.data
+  rm ./.mdd/config.yaml
   run $BATS_CWD/mdd verify
   [ "$status" -eq 1 ]
-  [ "${lines[0]}" = "File '.mdd/project.data' doesnt exist" ]
+  [ "${lines[0]}" = "File '.mdd/config.yaml' doesnt exist" ]
 }
 
 @test "mdd verify, remove documents directory" {
@@ -140,6 +140,17 @@ setup() {
   [ "${lines[0]}" = "Document '${file}' unrecognised metadata tag 'mdd-unknown'" ]
 }
 
+@test "mdd verify, invalid metadata date time" {
+  $BATS_CWD/mdd init
+  file_path=$($BATS_CWD/mdd new adr)
+  file=$(basename ${file_path})
+  sed -i.bak "s/^mdd-date-time: .*/mdd-date-time: yesterday/" ${file_path}
+  rm ${file_path}.bak
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Document '${file}' metadata 'mdd-date-time' is invalid, 'yesterday' is not a date time, expected YYYY-MM-DDThh:mm:ssZ" ]
+}
+
 @test "mdd verify, invalid metadata tag - key without value" {
   $BATS_CWD/mdd init
   file_path=$($BATS_CWD/mdd new adr)
@@ -176,3 +187,176 @@ setup() {
   run $BATS_CWD/mdd verify
   [ "$status" -eq 0 ]
 }
+
+@test "mdd verify, invalid typed link" {
+  $BATS_CWD/mdd init
+  parent=$(basename $($BATS_CWD/mdd new att))
+  child_path=$($BATS_CWD/mdd new req)
+  child=$(basename ${child_path})
+  $BATS_CWD/mdd link -r verifies ${parent} ${child}
+  rm ${child_path}
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Document '${parent}' has child '${child}' (verifies) which doesnt exist" ]
+}
+
+@test "mdd verify, links-to rule broken" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  $BATS_CWD/mdd config set verify.rules "req links-to att itst"
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Document '${req}' must link to one of: att, itst" ]
+}
+
+@test "mdd verify, links-to rule satisfied" {
+  $BATS_CWD/mdd init
+  req=$(basename $($BATS_CWD/mdd new req))
+  itst=$(basename $($BATS_CWD/mdd new itst))
+  $BATS_CWD/mdd link ${req} ${itst}
+  $BATS_CWD/mdd config set verify.rules "req links-to att itst"
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 0 ]
+}
+
+@test "mdd verify, linked-from rule broken" {
+  $BATS_CWD/mdd init
+  adr=$(basename $($BATS_CWD/mdd new adr))
+  mtg=$(basename $($BATS_CWD/mdd new mtg))
+  $BATS_CWD/mdd link ${adr} ${mtg}
+  $BATS_CWD/mdd config set verify.rules "adr linked-from mtg"
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Document '${adr}' must be linked from one of: mtg" ]
+}
+
+@test "mdd verify, linked-from rule satisfied" {
+  $BATS_CWD/mdd init
+  adr=$(basename $($BATS_CWD/mdd new adr))
+  mtg=$(basename $($BATS_CWD/mdd new mtg))
+  $BATS_CWD/mdd link ${mtg} ${adr}
+  $BATS_CWD/mdd config set verify.rules "adr linked-from mtg"
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 0 ]
+}
+
+@test "mdd verify, invalid rule" {
+  $BATS_CWD/mdd init
+  echo "verify-rule: req needs att" >> ./.mdd/project.data
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Invalid verify rule 'req needs att', expected 'links-to' or 'linked-from' not 'needs'" ]
+}
+
+@test "mdd verify --format csv" {
+  $BATS_CWD/mdd init
+  parent=$(basename $($BATS_CWD/mdd new adr))
+  child_path=$($BATS_CWD/mdd new adr)
+  child=$(basename ${child_path})
+  $BATS_CWD/mdd link ${parent} ${child}
+  rm ${child_path}
+  run $BATS_CWD/mdd verify --format csv
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "document,code,message" ]
+  [ "${lines[1]}" = "${parent},missing-child,Document '${parent}' has child '${child}' which doesnt exist" ]
+  [ "${#lines[@]}" -eq 2 ]
+}
+
+@test "mdd verify --format json, valid" {
+  $BATS_CWD/mdd init
+  run $BATS_CWD/mdd verify --format json
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "[]" ]
+}
+
+@test "mdd verify, inline link to missing document" {
+  $BATS_CWD/mdd init
+  doc_path=$($BATS_CWD/mdd new adr)
+  doc=$(basename ${doc_path})
+  echo "See [login](req-00-0009.md)" >> ${doc_path}
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Document '${doc}' has inline link 'req-00-0009.md' which doesnt exist" ]
+}
+
+@test "mdd verify, inline link that is not a child" {
+  $BATS_CWD/mdd init
+  doc_path=$($BATS_CWD/mdd new att)
+  doc=$(basename ${doc_path})
+  req=$(basename $($BATS_CWD/mdd new req))
+  echo "See [login](${req}#happy-path)" >> ${doc_path}
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "Warning: Document '${doc}' has inline link '${req}' which is not a child, run 'mdd verify -link-inline' to add it" ]
+  run $BATS_CWD/mdd verify --format json
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "[]" ]
+  $BATS_CWD/mdd link ${doc} ${req}
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 0 ]
+  [ "${#lines[@]}" -eq 0 ]
+}
+
+@test "mdd verify -link-inline, adds child links" {
+  $BATS_CWD/mdd init
+  doc_path=$($BATS_CWD/mdd new att)
+  doc=$(basename ${doc_path})
+  req=$(basename $($BATS_CWD/mdd new req))
+  echo "See [login](./${req})" >> ${doc_path}
+  run $BATS_CWD/mdd verify -link-inline
+  [ "$status" -eq 0 ]
+  [ "${lines[0]}" = "${doc} -> ${req}" ]
+  run $BATS_CWD/mdd parents ${req}
+  [ $(expr "${lines[0]}" : "^${doc}") -ne 0 ]
+  run grep -c "^mdd-last-modified-by: " ${doc_path}
+  [ "${lines[0]}" = "1" ]
+}
+
+@test "mdd verify, ignores external links" {
+  $BATS_CWD/mdd init
+  doc_path=$($BATS_CWD/mdd new adr)
+  echo "See [readme](https://example.com/README.md)" >> ${doc_path}
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 0 ]
+}
+
+@test "mdd verify, template sections" {
+  $BATS_CWD/mdd init
+  adr=$(basename $($BATS_CWD/mdd new adr))
+  mtg=$(basename $($BATS_CWD/mdd new mtg))
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 0 ]
+}
+
+@test "mdd verify, missing and empty sections" {
+  $BATS_CWD/mdd init
+  doc_path=$($BATS_CWD/mdd new mtg)
+  doc=$(basename ${doc_path})
+  # Remove the Purpose section, and empty the Agreement section
+  sed -i.bak -e '/^## Purpose$/,/^## Discussion$/{/^## Discussion$/!d;}' -e '/^## Agreement$/,/^## Action items$/{/^## /!d;}' ${doc_path}
+  rm ${doc_path}.bak
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Document '${doc}' missing required section 'Purpose'" ]
+  [ "${lines[1]}" = "Document '${doc}' section 'Agreement' is empty" ]
+}
+
+@test "mdd verify, sections out of order" {
+  $BATS_CWD/mdd init
+  printf "\n<!-- mdd-template\nmdd-section: required Login\nmdd-section: optional Notes\n-->\n" >> ./.mdd/templates/att.md
+  doc_path=$($BATS_CWD/mdd new att)
+  doc=$(basename ${doc_path})
+  printf "\n## Notes\n\nSome notes\n\n## login\n\n### Steps\n\nOpen the page\n" >> ${doc_path}
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 1 ]
+  [ "${lines[0]}" = "Document '${doc}' section 'Notes' should come after 'Login'" ]
+  [ "${#lines[@]}" -eq 2 ]
+}
+
+@test "mdd verify, invalid template section" {
+  $BATS_CWD/mdd init
+  printf "\n<!-- mdd-template\nmdd-section: Login\n-->\n" >> ./.mdd/templates/att.md
+  run $BATS_CWD/mdd verify
+  [ "$status" -eq 1 ]
+  [ $(expr "${lines[0]}" : "Template '.*att.md' invalid section 'Login', expected 'required|optional heading'") -ne 0 ]
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Name of the merge driver in .gitattributes and the git config
+	MergeDriverName = "mdd"
+
+	// Replaces the metadata block while the bodies are merged
+	mergeMetadataPlaceholder = "<!-- mdd-merge-metadata -->"
+)
+
+var (
+	// Metadata keys that may appear many times, and are merged as sets
+	multiValueKeyRegex *regexp.Regexp
+	// The metadata block, without the blank lines around it
+	mergeMetaBlockRegex *regexp.Regexp
+)
+
+func init() {
+	mergeMetaBlockRegex = regexp.MustCompile("(?ms)^[ \\t]*<!-- mdd[ \\t]*$.*?^[ \\t]*-->[ \\t]*$")
+	multiValueKeyRegex = regexp.MustCompile("^(" + MetadataChild + "|" + MetadataChildType + "[\\w-]+|" + MetadataTag + "):")
+}
+
+// mergeVersion is one of the three versions of a document being merged
+type mergeVersion struct {
+	// The document with the metadata block replaced by mergeMetadataPlaceholder
+	body []byte
+	// Set of multi-value metadata lines, eg: 'mdd-tag: security'
+	sets map[string]bool
+	// Map from key -> value for the single value metadata, eg: 'mdd-status'
+	values map[string]string
+}
+
+func readMergeVersion(path string) (mergeVersion, bool, error) {
+	v := mergeVersion{sets: make(map[string]bool), values: make(map[string]string)}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return v, false, err
+	}
+	block := mergeMetaBlockRegex.Find(raw)
+	if block == nil {
+		v.body = raw
+		return v, false, nil
+	}
+	v.body = mergeMetaBlockRegex.ReplaceAll(raw, []byte(mergeMetadataPlaceholder))
+	for _, l := range strings.Split(string(block), LineBreak) {
+		l = strings.TrimSpace(l)
+		if l == "" || metaStartRegex.MatchString(l) || metaEndRegex.MatchString(l) {
+			continue
+		}
+		kv := strings.SplitN(l, MetadataSeparator, 2)
+		if len(kv) != 2 {
+			return v, false, fmt.Errorf("File '%s' invalid metadata '%s'", path, l)
+		}
+		key := strings.TrimSpace(kv[0])
+		value := strings.TrimSpace(kv[1])
+		line := fmt.Sprintf("%s: %s", key, value)
+		if multiValueKeyRegex.MatchString(line) {
+			v.sets[line] = true
+		} else {
+			v.values[key] = value
+		}
+	}
+	return v, true, nil
+}
+
+// mergeSets keeps a line if both sides have it, or one side added it
+func mergeSets(base, ours, theirs map[string]bool) []string {
+	merged := []string{}
+	all := make(map[string]bool)
+	for _, s := range []map[string]bool{ours, theirs} {
+		for l := range s {
+			all[l] = true
+		}
+	}
+	for l := range all {
+		if (ours[l] && theirs[l]) || (ours[l] && !base[l]) || (theirs[l] && !base[l]) {
+			merged = append(merged, l)
+		}
+	}
+	return merged
+}
+
+// mergeValues takes the side that changed each value, and returns conflict
+// markers if both sides changed it differently
+func mergeValues(base, ours, theirs map[string]string) ([]string, int) {
+	merged := []string{}
+	conflicts := 0
+	keys := make(map[string]bool)
+	for _, s := range []map[string]string{base, ours, theirs} {
+		for k := range s {
+			keys[k] = true
+		}
+	}
+	for k := range keys {
+		value := ours[k]
+		if ours[k] != theirs[k] && ours[k] == base[k] {
+			value = theirs[k]
+		} else if ours[k] != theirs[k] && theirs[k] != base[k] {
+			merged = append(merged, fmt.Sprintf("<<<<<<< ours\n%s: %s\n=======\n%s: %s\n>>>>>>> theirs", k, ours[k], k, theirs[k]))
+			conflicts++
+			continue
+		}
+		if value != "" {
+			merged = append(merged, fmt.Sprintf("%s: %s", k, value))
+		}
+	}
+	return merged, conflicts
+}
+
+// keepLatestModified stops both sides changing the last modified time being a
+// conflict, by giving both sides the latest time and its author
+func keepLatestModified(base, ours, theirs map[string]string) {
+	at := MetadataModifiedAt
+	if ours[at] == theirs[at] || ours[at] == base[at] || theirs[at] == base[at] {
+		return
+	}
+	oursTime, errOurs := time.Parse(DateTimeFormat, ours[at])
+	theirsTime, errTheirs := time.Parse(DateTimeFormat, theirs[at])
+	latest, other := ours, theirs
+	if errOurs != nil || (errTheirs == nil && theirsTime.After(oursTime)) {
+		latest, other = theirs, ours
+	}
+	other[at] = latest[at]
+	other[MetadataModifiedBy] = latest[MetadataModifiedBy]
+}
+
+// metadataOrder sorts lines as written by Document.WriteDocument, the status,
+// then authors & times, then children, then tags, then anything else
+func metadataOrder(line string) string {
+	switch {
+	case strings.HasPrefix(line, MetadataStatus+":"):
+		return "0"
+	case strings.HasPrefix(line, MetadataAuthor+":"):
+		return "01"
+	case strings.HasPrefix(line, MetadataDateTime+":"):
+		return "02"
+	case strings.HasPrefix(line, MetadataModifiedBy+":"):
+		return "03"
+	case strings.HasPrefix(line, MetadataModifiedAt+":"):
+		return "04"
+	case strings.HasPrefix(line, MetadataChild):
+		// Sort by the child filename
+		return "1" + strings.TrimSpace(strings.SplitN(line, MetadataSeparator, 2)[1])
+	case strings.HasPrefix(line, MetadataTag+":"):
+		return "2" + line
+	}
+	return "3" + strings.TrimPrefix(line, "<<<<<<< ours\n")
+}
+
+// MergeFiles performs a three-way merge of a document, writing the result to
+// ours. The metadata is merged as sets of children & tags, and the rest of the
+// document as text with 'git merge-file'. Returns the number of conflicts
+func MergeFiles(base, ours, theirs string) (int, error) {
+	versions := []mergeVersion{}
+	allMeta := true
+	for _, path := range []string{base, ours, theirs} {
+		v, hasMeta, err := readMergeVersion(path)
+		if err != nil {
+			return 0, err
+		}
+		versions = append(versions, v)
+		allMeta = allMeta && hasMeta
+	}
+	// Without metadata in every version, just merge the text
+	if !allMeta {
+		return gitMergeFile(ours, base, theirs, ours)
+	}
+
+	// Merge the bodies, with the metadata blocks replaced by the placeholder
+	tmpDir, err := ioutil.TempDir("", "mdd-merge")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tmpDir)
+	paths := []string{}
+	for i, name := range []string{"base", "ours", "theirs"} {
+		path := filepath.Join(tmpDir, name)
+		if err := ioutil.WriteFile(path, versions[i].body, 0644); err != nil {
+			return 0, err
+		}
+		paths = append(paths, path)
+	}
+	conflicts, err := gitMergeFile(paths[1], paths[0], paths[2], paths[1])
+	if err != nil {
+		return conflicts, err
+	}
+	body, err := ioutil.ReadFile(paths[1])
+	if err != nil {
+		return conflicts, err
+	}
+
+	// Merge the metadata
+	keepLatestModified(versions[0].values, versions[1].values, versions[2].values)
+	meta := mergeSets(versions[0].sets, versions[1].sets, versions[2].sets)
+	values, valueConflicts := mergeValues(versions[0].values, versions[1].values, versions[2].values)
+	meta = append(meta, values...)
+	sort.Slice(meta, func(i, j int) bool { return metadataOrder(meta[i]) < metadataOrder(meta[j]) })
+	block := strings.Join(append(append([]string{MetadataStart}, meta...), MetadataEnd), LineBreak)
+
+	merged := bytes.Replace(body, []byte(mergeMetadataPlaceholder), []byte(block), 1)
+	return conflicts + valueConflicts, ioutil.WriteFile(ours, merged, 0644)
+}
+
+// gitMergeFile merges the changes from base to theirs into ours, writing the
+// result to out, and returns the number of conflicts
+func gitMergeFile(ours, base, theirs, out string) (int, error) {
+	cmd := exec.Command("git", "merge-file", "-p", "-L", "ours", "-L", "base", "-L", "theirs", ours, base, theirs)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	merged, err := cmd.Output()
+	conflicts := 0
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() > 0 && exitErr.ExitCode() < 128 {
+		// The exit code is the number of conflicts
+		conflicts = exitErr.ExitCode()
+	} else if err != nil {
+		return 0, fmt.Errorf("git merge-file failed: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return conflicts, ioutil.WriteFile(out, merged, 0644)
+}
+
+// InstallMergeDriver configures git to merge the documents in the project with
+// 'mdd merge-driver', by adding to .gitattributes next to the .mdd directory and
+// to the repository git config. Returns the .gitattributes path
+func (p *Project) InstallMergeDriver() (string, error) {
+	dir := filepath.Dir(p.HomePath)
+	pattern := filepath.ToSlash(filepath.Join(RootDirectory, "documents", "*.md"))
+	attribute := fmt.Sprintf("%s merge=%s", pattern, MergeDriverName)
+
+	attrPath := filepath.Join(dir, ".gitattributes")
+	existing, err := ioutil.ReadFile(attrPath)
+	if err != nil && !os.IsNotExist(err) {
+		return attrPath, err
+	}
+	found := false
+	for _, l := range strings.Split(string(existing), LineBreak) {
+		if strings.TrimSpace(l) == attribute {
+			found = true
+		}
+	}
+	if !found {
+		if len(existing) > 0 && !bytes.HasSuffix(existing, []byte(LineBreak)) {
+			existing = append(existing, LineBreak...)
+		}
+		existing = append(existing, (attribute + LineBreak)...)
+		if err := ioutil.WriteFile(attrPath, existing, 0644); err != nil {
+			return attrPath, err
+		}
+	}
+
+	config := [][]string{
+		{fmt.Sprintf("merge.%s.name", MergeDriverName), "mdd document metadata merge driver"},
+		{fmt.Sprintf("merge.%s.driver", MergeDriverName), "mdd merge-driver %O %A %B"},
+	}
+	for _, kv := range config {
+		if _, err := runGit(dir, "config", kv[0], kv[1]); err != nil {
+			return attrPath, err
+		}
+	}
+	return attrPath, nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatCSV  = "csv"
+)
+
+// OutputFormats are the values accepted by the --format option
+var OutputFormats = []string{FormatText, FormatJSON, FormatYAML, FormatCSV}
+
+// errSilentFailure causes a non zero exit without printing anything more, so
+// that machine readable output is not followed by a human readable message
+var errSilentFailure = fmt.Errorf("")
+
+// Record is implemented by each of the structures that commands output in a
+// machine readable format
+type Record interface {
+	CSVRow() []string
+}
+
+type LinkRecord struct {
+	Filename string `json:"filename" yaml:"filename"`
+	Relation string `json:"relation,omitempty" yaml:"relation,omitempty"`
+}
+
+type DocumentRecord struct {
+	Filename string        `json:"filename" yaml:"filename"`
+	Title    string        `json:"title" yaml:"title"`
+	Template string        `json:"template" yaml:"template"`
+	Status   string        `json:"status" yaml:"status"`
+	Tags     []string      `json:"tags" yaml:"tags"`
+	Children []LinkRecord  `json:"children" yaml:"children"`
+	Fields   []FieldRecord `json:"fields" yaml:"fields"`
+	// Who created & last changed the document, and when
+	Author     string `json:"author,omitempty" yaml:"author,omitempty"`
+	Created    string `json:"created,omitempty" yaml:"created,omitempty"`
+	ModifiedBy string `json:"modified-by,omitempty" yaml:"modified-by,omitempty"`
+	ModifiedAt string `json:"modified-at,omitempty" yaml:"modified-at,omitempty"`
+}
+
+type FieldRecord struct {
+	Name  string `json:"name" yaml:"name"`
+	Value string `json:"value" yaml:"value"`
+}
+
+type TemplateRecord struct {
+	Shortcut string `json:"shortcut" yaml:"shortcut"`
+	Title    string `json:"title" yaml:"title"`
+}
+
+type InfoRecord struct {
+	Project   string `json:"project" yaml:"project"`
+	Path      string `json:"path" yaml:"path"`
+	Templates int    `json:"templates" yaml:"templates"`
+	Documents int    `json:"documents" yaml:"documents"`
+}
+
+type ErrorRecord struct {
+	Document string `json:"document" yaml:"document"`
+	Code     string `json:"code" yaml:"code"`
+	Message  string `json:"message" yaml:"message"`
+}
+
+func (d *Document) ForRecord() DocumentRecord {
+	r := DocumentRecord{
+		Filename: d.BaseFilename(),
+		Title:    d.Title,
+		Template: d.Template.Shortcut,
+		Status:   d.Status,
+		Tags:     d.TagNames(),
+		Children: []LinkRecord{},
+		Fields:   []FieldRecord{},
+
+		Author:     d.Author,
+		Created:    d.DateTime,
+		ModifiedBy: d.ModifiedBy,
+		ModifiedAt: d.ModifiedAt,
+	}
+	for _, name := range d.ChildrenNames() {
+		r.Children = append(r.Children, LinkRecord{Filename: name, Relation: d.Relation(name)})
+	}
+	for _, name := range d.FieldNames() {
+		r.Fields = append(r.Fields, FieldRecord{Name: name, Value: d.Fields[name]})
+	}
+	return r
+}
+
+func (r DocumentRecord) CSVHeader() []string {
+	return []string{"filename", "title", "template", "status", "tags", "children", "fields", "author", "created", "modified-by", "modified-at"}
+}
+
+// CSVRow joins tags, children and fields with spaces, a typed child is written as
+// 'filename:relation' and a field as 'name=value'
+func (r DocumentRecord) CSVRow() []string {
+	children := []string{}
+	for _, c := range r.Children {
+		if c.Relation != "" {
+			children = append(children, fmt.Sprintf("%s:%s", c.Filename, c.Relation))
+		} else {
+			children = append(children, c.Filename)
+		}
+	}
+	fields := []string{}
+	for _, f := range r.Fields {
+		fields = append(fields, fmt.Sprintf("%s=%s", f.Name, f.Value))
+	}
+	return []string{r.Filename, r.Title, r.Template, r.Status, strings.Join(r.Tags, " "), strings.Join(children, " "), strings.Join(fields, " "), r.Author, r.Created, r.ModifiedBy, r.ModifiedAt}
+}
+
+func (r TemplateRecord) CSVHeader() []string {
+	return []string{"shortcut", "title"}
+}
+
+func (r TemplateRecord) CSVRow() []string {
+	return []string{r.Shortcut, r.Title}
+}
+
+func (r InfoRecord) CSVHeader() []string {
+	return []string{"project", "path", "templates", "documents"}
+}
+
+func (r InfoRecord) CSVRow() []string {
+	return []string{r.Project, r.Path, fmt.Sprintf("%d", r.Templates), fmt.Sprintf("%d", r.Documents)}
+}
+
+func (r ErrorRecord) CSVHeader() []string {
+	return []string{"document", "code", "message"}
+}
+
+func (r ErrorRecord) CSVRow() []string {
+	return []string{r.Document, r.Code, r.Message}
+}
+
+// errorRecord converts err into an ErrorRecord, errors not about a single
+// document are given the 'project' code
+func errorRecord(err error) ErrorRecord {
+	if de, ok := err.(*DocumentError); ok {
+		return ErrorRecord{Document: de.Document, Code: de.Code, Message: de.Message}
+	}
+	return ErrorRecord{Code: "project", Message: strings.TrimSpace(err.Error())}
+}
+
+func validFormat(format string) error {
+	return checkFormat(format, OutputFormats)
+}
+
+// checkFormat returns an error if format isnt one of formats, for commands
+// with their own set of formats
+func checkFormat(format string, formats []string) error {
+	for _, f := range formats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown format '%s', expected one of: %s", format, strings.Join(formats, ", "))
+}
+
+// writeRecords writes records to out in a machine readable format. value is
+// what gets marshalled for json and yaml, so a single record can be written
+// as an object rather than a list. header is the csv header row
+func writeRecords(out io.Writer, format string, value interface{}, header []string, records []Record) error {
+	switch format {
+	case FormatJSON:
+		b, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "%s\n", b)
+		return err
+	case FormatYAML:
+		b, err := yaml.Marshal(value)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(b)
+		return err
+	case FormatCSV:
+		w := csv.NewWriter(out)
+		if err := w.Write(header); err != nil {
+			return err
+		}
+		for _, r := range records {
+			if err := w.Write(r.CSVRow()); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		return w.Error()
+	}
+	return validFormat(format)
+}
@@ -9,6 +9,7 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 
 	"github.com/GeertJohan/go.rice"
 )
@@ -17,10 +18,11 @@ import (
 //
 // ./tmp
 // └── .mdd							<- HomePath
-//     ├── documents		<- DocumentPath : Documents live in here
-//     ├── project.data <- A textual database containing project meadata
-//     ├── publish			<- PublishPath: Publish the documents as an HTML website here
-//     └── templates		<- TemplatePath: All the template files available to this project
+//
+//	├── config.yaml	<- Project configuration, see Config
+//	├── documents		<- DocumentPath : Documents live in here
+//	├── publish			<- PublishPath: Publish the documents as an HTML website here, see Config.Publish.Dir
+//	└── templates		<- TemplatePath: All the template files available to this project
 type Project struct {
 	HomePath     string
 	TemplatePath string
@@ -28,13 +30,39 @@ type Project struct {
 	PublishPath  string
 	Templates    []Template
 	Documents    []*Document
+	Config       Config
+
+	// Reverse index of links, maps a child filename -> filenames of its parents
+	parents map[string][]string
+	// Name of the user running mdd, see Author
+	author string
 }
 
 const (
 	RootDirectory = ".mdd"
-	ProjectDbFile = "project.data"
+	// Project database written by older versions, migrated to ConfigFile
+	ProjectDbFile    = "project.data"
+	ProjectDbProject = "project"
+	IndexHTMLFile    = "index.html"
+	// Template for each published document page
+	DocumentHTMLFile = "document.html"
 )
 
+// This structure is used for the index.html template output
+type IndexView struct {
+	// Map from tags -> DocView with that tag
+	TagDocs map[string][]DocView
+
+	// Map from Template filename to Documents following that template
+	TmplDocs map[string][]DocView
+
+	// Map from Template filename to Template title
+	TmplTitles map[string]string
+
+	// Map from filename -> DocView
+	FilenameDocs map[string]DocView
+}
+
 var (
 	box       *rice.Box
 	fileRegex regexp.Regexp
@@ -74,12 +102,13 @@ func NewProject(projectDir, name *string) (Project, error) {
 
 	p.TemplatePath = path.Join(p.HomePath, "templates")
 	p.DocumentPath = path.Join(p.HomePath, "documents")
-	p.PublishPath = path.Join(p.HomePath, "publish")
+	p.Config = DefaultConfig(*name)
+	p.PublishPath = p.publishPath()
 
-	// Create our project database file
-	log.Printf("Writing project database file")
-	if err := p.writeProjectDb(map[string]string{"project": *name}); err != nil {
-		log.Printf("Error writing project file: '%v'\n", err)
+	// Create our project config file
+	log.Printf("Writing project config file")
+	if err := p.writeConfig(); err != nil {
+		log.Printf("Error writing project config file: '%v'\n", err)
 		return p, err
 	}
 
@@ -121,12 +150,18 @@ func NewProject(projectDir, name *string) (Project, error) {
 				log.Printf("Error writing template: '%s' to path '%s', %v\n", pth, tmplPath, err)
 				return err
 			}
+			// Keep the built-in version for 'mdd templates upgrade'
+			return p.recordTemplateBase(pth, b)
 		}
 		return nil
 	})
 	if err != nil {
 		return p, err
 	}
+	if err := p.writeConfig(); err != nil {
+		log.Printf("Error writing project config file: '%v'\n", err)
+		return p, err
+	}
 	// Return a correctly initialised Project structure
 	return ReadProject(p.HomePath, false)
 }
@@ -199,7 +234,18 @@ func ReadProject(homePath string, ignoreBrokenFiles bool) (Project, error) {
 	p := Project{HomePath: homePath}
 	p.TemplatePath = path.Join(p.HomePath, "templates")
 	p.DocumentPath = path.Join(p.HomePath, "documents")
-	p.PublishPath = path.Join(p.HomePath, "publish")
+
+	// Read the config, from project.data if written by an older version
+	if err := p.migrateProjectDb(); err != nil {
+		return p, err
+	}
+	if !fileExists(p.ConfigPath()) {
+		return p, fmt.Errorf("File '%s' doesnt exist", p.ConfigPath())
+	}
+	if err := p.readConfig(); err != nil {
+		return p, err
+	}
+	p.PublishPath = p.publishPath()
 
 	// Check that essential directories exist
 	if !directoryExists(p.TemplatePath) {
@@ -211,9 +257,6 @@ func ReadProject(homePath string, ignoreBrokenFiles bool) (Project, error) {
 	if !directoryExists(p.PublishPath) {
 		return p, fmt.Errorf("Directory '%s' doesnt exist", p.PublishPath)
 	}
-	if !fileExists(p.ProjectDbPath()) {
-		return p, fmt.Errorf("File '%s' doesnt exist", p.ProjectDbPath())
-	}
 
 	// Read the templates
 	err := filepath.Walk(p.TemplatePath, func(path string, info os.FileInfo, err error) error {
@@ -265,10 +308,45 @@ func ReadProject(homePath string, ignoreBrokenFiles bool) (Project, error) {
 	if err != nil {
 		return p, err
 	}
+	p.indexParents()
 
 	return p, err
 }
 
+// indexParents builds the reverse index of links, from each child to its parents
+func (p *Project) indexParents() {
+	p.parents = make(map[string][]string)
+	for _, d := range p.Documents {
+		for _, name := range d.ChildrenNames() {
+			p.parents[name] = append(p.parents[name], d.BaseFilename())
+		}
+	}
+	for _, names := range p.parents {
+		sort.Strings(names)
+	}
+}
+
+// ParentNames returns the sorted filenames of the documents that link to d
+func (p *Project) ParentNames(d *Document) []string {
+	if p.parents == nil {
+		p.indexParents()
+	}
+	return p.parents[d.BaseFilename()]
+}
+
+// DocView returns the view of d, including the documents that link to it
+func (p *Project) DocView(d *Document) DocView {
+	dv := d.ForView()
+	dv.Parents = p.ParentNames(d)
+	dv.ParentRelations = make(map[string]string)
+	for _, name := range dv.Parents {
+		if parent := p.FindDocument(name); parent != nil {
+			dv.ParentRelations[name] = parent.Relation(dv.BaseFilename)
+		}
+	}
+	return dv
+}
+
 func (p *Project) FindDocument(filename string) *Document {
 	for _, d := range p.Documents {
 		if d.BaseFilename() == filename {
@@ -278,10 +356,13 @@ func (p *Project) FindDocument(filename string) *Document {
 	return nil
 }
 
-func (p *Project) Delete(filename string) error {
+// Delete deletes the document, removing the links to it, and clearing the
+// doc-ref fields that refer to it. Returns a description of each field cleared
+func (p *Project) Delete(filename string) ([]string, error) {
 
 	var doc *Document
 	var idx int
+	cleared := []string{}
 
 	// Find the document & its index
 	for i, d := range p.Documents {
@@ -293,32 +374,46 @@ func (p *Project) Delete(filename string) error {
 	}
 
 	if doc == nil {
-		return fmt.Errorf("Cant find file: '%s'", filename)
+		return cleared, fmt.Errorf("Cant find file: '%s'", filename)
 	}
 
 	for _, d := range p.Documents {
+		changed := false
 		if d.HasChild(doc) {
 			if err := d.RemoveChild(doc.BaseFilename()); err != nil {
-				return err
+				return cleared, err
 			}
+			changed = true
+		}
+		for _, name := range d.FieldNames() {
+			if f := d.Template.FindField(name); f != nil && f.Type == FieldDocRef && d.Fields[name] == filename {
+				delete(d.Fields, name)
+				cleared = append(cleared, fmt.Sprintf("Cleared field '%s' of '%s', it referred to '%s'", name, d.BaseFilename(), filename))
+				changed = true
+			}
+		}
+		if changed {
 			if err := d.WriteDocument(); err != nil {
-				return err
+				return cleared, err
 			}
 		}
 	}
 
 	if err := doc.Delete(); err != nil {
-		return err
+		return cleared, err
 	}
 
 	// Remove the document from the set
 	p.Documents = append(p.Documents[:idx], p.Documents[idx+1:]...)
+	p.parents = nil
 
-	return nil
+	return cleared, nil
 }
 
-func (p *Project) readProjectDb() (map[string]string, error) {
-	db := map[string]string{}
+// readProjectDb returns the values for each key in the project database, a key
+// may appear on more than one line. Only used to migrate to the config file
+func (p *Project) readProjectDb() (map[string][]string, error) {
+	db := map[string][]string{}
 	dbPath := p.ProjectDbPath()
 	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
 		return db, nil
@@ -333,61 +428,71 @@ func (p *Project) readProjectDb() (map[string]string, error) {
 	// The regex to match
 	// key: value one
 	// in our file
-	re := regexp.MustCompile("^[[:space:]]*([[:word:]]-)+:[[:space:]]+([[:word:]] -)+[[:space:]]*$")
-	r := bufio.NewReader(f)
-	s, e := r.ReadString('\n')
-	for e == nil {
-		matches := re.FindAllString(s, -1)
-		if len(matches) == 0 {
-			db[matches[0]] = matches[1]
+	re := regexp.MustCompile("^[[:space:]]*([[:word:]-]+):[[:space:]]*(.*?)[[:space:]]*$")
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		matches := re.FindStringSubmatch(scanner.Text())
+		if len(matches) == 3 {
+			db[matches[1]] = append(db[matches[1]], matches[2])
 		}
-		s, e = r.ReadString('\n')
 	}
-	return db, nil
+	return db, scanner.Err()
 }
 
-func (p *Project) writeProjectDb(db map[string]string) error {
-	dbPath := p.ProjectDbPath()
-	f, err := os.Create(dbPath)
+// DeleteAllPublished deletes the files 'mdd publish' writes, the pages listed in
+// the manifest or named like a document page, the index, trace & search files
+// and the manifest. Any other files in the publish directory are left alone
+func (p *Project) DeleteAllPublished() error {
+	// The manifest may be invalid, 'mdd publish -f' is how it is rebuilt
+	m, _ := readManifest(filepath.Join(p.PublishPath, ManifestFile))
+	published := []string{ManifestFile, IndexHTMLFile, TraceHTMLFile, SearchIndexFile}
+
+	dirFiles, err := ioutil.ReadDir(p.PublishPath)
 	if err != nil {
 		return err
 	}
-	f.WriteString("# mdd project db file. Do not edit\n")
-	for k, v := range db {
-		_, err := f.WriteString(fmt.Sprintf("%s: %s\n", k, v))
-		if err != nil {
+	for _, f := range dirFiles {
+		_, listed := m[f.Name()]
+		if f.IsDir() || !(listed || htmlFilenameRegex.MatchString(f.Name()) || containsAny([]string{f.Name()}, published)) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(p.PublishPath, f.Name())); err != nil {
 			return err
 		}
 	}
-	err = f.Sync()
-	if err != nil {
-		return err
-	}
 	return nil
 }
 
-func (p *Project) DeleteAllPublished() error {
-	// Open the directory and read all its files.
-	dirRead, err := os.Open(p.PublishPath)
-	if err != nil {
-		return err
-	}
-	dirFiles, err := dirRead.Readdir(0)
-	if err != nil {
-		return err
+// ForIndexView builds up the data structure used to render index.html
+func (p *Project) ForIndexView() IndexView {
+	data := IndexView{
+		TagDocs:      make(map[string][]DocView),
+		TmplDocs:     make(map[string][]DocView),
+		TmplTitles:   make(map[string]string),
+		FilenameDocs: make(map[string]DocView),
 	}
 
-	// Loop over the directory's files.
-	for _, f := range dirFiles {
+	for _, d := range p.Documents {
 
-		// Get name of file and its full path.
-		fullPath := filepath.Join(p.PublishPath, f.Name())
+		dv := p.DocView(d)
 
-		// Remove the file.
-		err = os.Remove(fullPath)
-		if err != nil {
-			return err
+		// Map by filename
+		data.FilenameDocs[dv.BaseFilename] = dv
+
+		// Index by Tag
+		for _, t := range d.TagNames() {
+			if data.TagDocs[t] == nil {
+				data.TagDocs[t] = make([]DocView, 0)
+			}
+			data.TagDocs[t] = append(data.TagDocs[t], dv)
 		}
+
+		// Index by Template
+		if data.TmplDocs[dv.TemplateFilename] == nil {
+			data.TmplDocs[dv.TemplateFilename] = make([]DocView, 0)
+			data.TmplTitles[dv.TemplateFilename] = dv.TemplateTitle
+		}
+		data.TmplDocs[dv.TemplateFilename] = append(data.TmplDocs[dv.TemplateFilename], dv)
 	}
-	return nil
+	return data
 }
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+const (
+	// Records the hash of each published document, so unchanged documents are
+	// not converted again
+	ManifestFile = "manifest.json"
+)
+
+// Manifest maps a published HTML filename to the hash of its inputs
+type Manifest map[string]string
+
+// PublishStats counts what a publish did
+type PublishStats struct {
+	Converted int
+	Unchanged int
+	Removed   int
+}
+
+var htmlFilenameRegex *regexp.Regexp
+
+func init() {
+	htmlFilenameRegex = regexp.MustCompile("^(\\w+)-(\\w+)-(\\d+)\\.html$")
+}
+
+func readManifest(path string) (Manifest, error) {
+	m := Manifest{}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	if err = json.Unmarshal(b, &m); err != nil {
+		return m, fmt.Errorf("Manifest '%s' is invalid, run 'mdd publish -f' to rebuild it: %v", path, err)
+	}
+	return m, nil
+}
+
+// publishHash returns a hash of everything that the documents HTML page
+// depends on, the page template, its own contents, its template title, the
+// titles of the documents it links to and from or refers to in doc-ref fields,
+// and which inline links and doc-ref fields resolve
+func (p *Project) publishHash(d *Document, pageTemplate []byte) string {
+	h := sha256.New()
+	h.Write(pageTemplate)
+	h.Write(d.raw)
+	io.WriteString(h, fmt.Sprintf("\n%s", d.Template.Title))
+	for _, name := range d.ChildrenNames() {
+		title := ""
+		if c := p.FindDocument(name); c != nil {
+			title = c.Title
+		}
+		io.WriteString(h, fmt.Sprintf("\n%s %s %s", name, d.Relation(name), title))
+	}
+	for _, link := range d.InlineLinks() {
+		io.WriteString(h, fmt.Sprintf("\n[] %s %t", link.Filename, p.FindDocument(link.Filename) != nil))
+	}
+	for _, f := range d.FieldViews() {
+		if !f.Ref {
+			continue
+		}
+		title := ""
+		ref := p.FindDocument(f.Value)
+		if ref != nil {
+			title = ref.Title
+		}
+		io.WriteString(h, fmt.Sprintf("\n@ %s %s %t %s", f.Name, f.Value, ref != nil, title))
+	}
+	for _, name := range p.ParentNames(d) {
+		if parent := p.FindDocument(name); parent != nil {
+			io.WriteString(h, fmt.Sprintf("\n<- %s %s %s", name, parent.Relation(d.BaseFilename()), parent.Title))
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// Publish converts the documents into a static website in p.PublishPath.
+// Only documents that changed since the last publish are converted, unless
+// full is true, in which case everything is deleted and rebuilt
+func (p *Project) Publish(full bool) (PublishStats, error) {
+	stats := PublishStats{}
+	manifestPath := filepath.Join(p.PublishPath, ManifestFile)
+
+	old := Manifest{}
+	if full {
+		if err := p.DeleteAllPublished(); err != nil {
+			return stats, err
+		}
+	} else {
+		var err error
+		if old, err = readManifest(manifestPath); err != nil {
+			return stats, err
+		}
+	}
+
+	pageSource, err := p.htmlTemplateSource(DocumentHTMLFile)
+	if err != nil {
+		return stats, err
+	}
+	pageTemplate, err := p.htmlTemplate(DocumentHTMLFile)
+	if err != nil {
+		return stats, err
+	}
+	docs := p.ForIndexView().FilenameDocs
+
+	current := Manifest{}
+	for _, d := range p.Documents {
+		hash := p.publishHash(d, pageSource)
+		current[d.HtmlFilename()] = hash
+		if old[d.HtmlFilename()] == hash && fileExists(filepath.Join(p.PublishPath, d.HtmlFilename())) {
+			stats.Unchanged++
+			continue
+		}
+		// log.Printf("Converting %s\n", d.Filename)
+		if err := d.ConvertToHTML(pageTemplate, docs, p.PublishPath); err != nil {
+			return stats, err
+		}
+		stats.Converted++
+	}
+
+	// Remove pages for documents that no longer exist
+	files, err := ioutil.ReadDir(p.PublishPath)
+	if err != nil {
+		return stats, err
+	}
+	for _, f := range files {
+		_, published := current[f.Name()]
+		_, previous := old[f.Name()]
+		if !published && (previous || htmlFilenameRegex.MatchString(f.Name())) {
+			if err := os.Remove(filepath.Join(p.PublishPath, f.Name())); err != nil {
+				return stats, err
+			}
+			stats.Removed++
+		}
+	}
+
+	// Create the index.html document
+	index, err := p.renderHTMLTemplate(IndexHTMLFile, p.ForIndexView())
+	if err != nil {
+		return stats, err
+	}
+	if err = writeFileIfChanged(filepath.Join(p.PublishPath, IndexHTMLFile), index); err != nil {
+		return stats, err
+	}
+
+	// Create the trace.html document
+	m := p.TraceMatrix(p.Config.Publish.TraceRows, p.Config.Publish.TraceCols)
+	if _, err = p.WriteTraceHTML(&m, p.PublishPath); err != nil {
+		return stats, err
+	}
+
+	// Create the search index used by index.html
+	if err = p.WriteSearchIndex(p.PublishPath); err != nil {
+		return stats, err
+	}
+
+	b, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return stats, err
+	}
+	return stats, writeFileIfChanged(manifestPath, b)
+}
+
+// renderHTMLTemplate executes the named project template with data
+func (p *Project) renderHTMLTemplate(name string, data interface{}) ([]byte, error) {
+	tmpl, err := p.htmlTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, data)
+	return b.Bytes(), err
+}
+
+// writeFileIfChanged leaves the file untouched if it already has contents, so
+// its modification time only changes when it needs uploading again
+func writeFileIfChanged(path string, contents []byte) error {
+	if existing, err := ioutil.ReadFile(path); err == nil && bytes.Equal(existing, contents) {
+		return nil
+	}
+	return ioutil.WriteFile(path, contents, 0644)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// FindTemplate returns the template with the shortcut, or nil
+func (p *Project) FindTemplate(shortcut string) *Template {
+	for i := range p.Templates {
+		if p.Templates[i].Shortcut == shortcut {
+			return &p.Templates[i]
+		}
+	}
+	return nil
+}
+
+// inlineLinkRegex matches an inline or reference style markdown link to one
+// of the filenames, with the filename in group 2
+func inlineLinkRegex(filenames []string) *regexp.Regexp {
+	quoted := []string{}
+	for _, f := range filenames {
+		quoted = append(quoted, regexp.QuoteMeta(f))
+	}
+	return regexp.MustCompile("(?m)(\\]\\(\\s*<?(?:[^\\s()<>]*/)?|^\\s*\\[[^\\]]+\\]:\\s*<?(?:[^\\s<>]*/)?)(" + strings.Join(quoted, "|") + ")([#\\s)>\"']|$)")
+}
+
+// Rename renames documents, from old -> new filename, and updates every child
+// link, inline link and doc-ref field that refers to them. A new filename may
+// use a different template shortcut, which moves the document to that template,
+// dropping the fields the new template doesnt declare, or that arent valid for
+// it. Returns a description of each field dropped
+func (p *Project) Rename(renames map[string]string) ([]string, error) {
+	dropped := []string{}
+	if len(renames) == 0 {
+		return dropped, nil
+	}
+	moving := make(map[string]*Document)
+	targets := make(map[string]bool)
+	// Map from old filename -> the fields to drop
+	dropFields := make(map[string][]string)
+	for from, to := range renames {
+		d := p.FindDocument(from)
+		if d == nil {
+			return dropped, fmt.Errorf("Cant find document '%s'", from)
+		}
+		matches := filenameRegex.FindStringSubmatch(to)
+		if len(matches) != 4 {
+			return dropped, fmt.Errorf("Document '%s' doesnt match mdd filename regex", to)
+		}
+		t := p.FindTemplate(matches[1])
+		if t == nil {
+			return dropped, fmt.Errorf("Document '%s' no template matching shortcode '%s'", to, matches[1])
+		}
+		if targets[to] {
+			return dropped, fmt.Errorf("Cant rename two documents to '%s'", to)
+		}
+		targets[to] = true
+		moving[from] = d
+		if t.Shortcut != d.Template.Shortcut {
+			for _, name := range d.FieldNames() {
+				if f := t.FindField(name); f == nil || f.checkValue(d.Fields[name]) != nil {
+					dropFields[from] = append(dropFields[from], name)
+				}
+			}
+		}
+	}
+	for to := range targets {
+		if _, ok := moving[to]; !ok && fileExists(filepath.Join(p.DocumentPath, to)) {
+			return dropped, fmt.Errorf("Document '%s' already exists", to)
+		}
+	}
+
+	// Update the references in every document, before renaming any files
+	froms := []string{}
+	for from := range renames {
+		froms = append(froms, from)
+	}
+	r := inlineLinkRegex(froms)
+	for _, d := range p.Documents {
+		changed := false
+		children := make(map[string]string)
+		for name, relation := range d.Children {
+			if to, ok := renames[name]; ok {
+				name = to
+				changed = true
+			}
+			children[name] = relation
+		}
+		d.Children = children
+		for name, value := range d.Fields {
+			if to, ok := renames[value]; ok {
+				if f := d.Template.FindField(name); f != nil && f.Type == FieldDocRef {
+					d.Fields[name] = to
+					changed = true
+				}
+			}
+		}
+		for _, name := range dropFields[d.BaseFilename()] {
+			to := renames[d.BaseFilename()]
+			dropped = append(dropped, fmt.Sprintf("Dropped field '%s' (%s) from '%s', template '%s' doesnt declare it or the value isnt valid", name, d.Fields[name], to, filenameRegex.FindStringSubmatch(to)[1]))
+			delete(d.Fields, name)
+			changed = true
+		}
+		if r.Match(d.raw) {
+			d.raw = r.ReplaceAllFunc(d.raw, func(link []byte) []byte {
+				m := r.FindSubmatch(link)
+				return []byte(string(m[1]) + renames[string(m[2])] + string(m[3]))
+			})
+			changed = true
+		}
+		if changed {
+			if err := d.WriteDocument(); err != nil {
+				return dropped, err
+			}
+		}
+	}
+
+	// Rename through temporary names, so documents can swap filenames
+	for _, d := range moving {
+		tmpPath := d.Filename + ".mdd-mv"
+		if err := os.Rename(d.Filename, tmpPath); err != nil {
+			return dropped, err
+		}
+		d.Filename = tmpPath
+	}
+	for from, d := range moving {
+		to := renames[from]
+		newPath := filepath.Join(p.DocumentPath, to)
+		if err := os.Rename(d.Filename, newPath); err != nil {
+			return dropped, err
+		}
+		d.Filename = newPath
+		d.Template = p.FindTemplate(filenameRegex.FindStringSubmatch(to)[1])
+	}
+	p.parents = nil
+	sort.Strings(dropped)
+	return dropped, nil
+}
+
+// Renumbering returns the renames that give every document a unique number,
+// numbered from 1 in the order of their current numbers
+func (p *Project) Renumbering() map[string]string {
+	docs := append([]*Document{}, p.Documents...)
+	number := func(d *Document) string {
+		return filenameRegex.FindStringSubmatch(d.BaseFilename())[3]
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		ni, nj := number(docs[i]), number(docs[j])
+		if len(ni) != len(nj) {
+			return len(ni) < len(nj)
+		}
+		if ni != nj {
+			return ni < nj
+		}
+		return docs[i].BaseFilename() < docs[j].BaseFilename()
+	})
+
+	renames := make(map[string]string)
+	for i, d := range docs {
+		matches := filenameRegex.FindStringSubmatch(d.BaseFilename())
+		to := fmt.Sprintf("%s-%s-%0*d.md", matches[1], matches[2], p.Config.IDs.Digits, i+1)
+		if to != d.BaseFilename() {
+			renames[d.BaseFilename()] = to
+		}
+	}
+	return renames
+}
+
+// sortedRenames returns the renames as 'old -> new' lines, sorted by old filename
+func sortedRenames(renames map[string]string) []string {
+	lines := []string{}
+	for from, to := range renames {
+		lines = append(lines, fmt.Sprintf("%s -> %s", from, to))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// withMdSuffix adds the '.md' suffix to a filename if it is missing
+func withMdSuffix(filename string) string {
+	if !strings.HasSuffix(filename, ".md") {
+		return fmt.Sprintf("%s.md", filename)
+	}
+	return filename
+}
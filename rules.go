@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// Coverage rule lines in project.data, written by older versions
+	ProjectDbVerifyRule = "verify-rule"
+	RuleLinksTo         = "links-to"
+	RuleLinkedFrom      = "linked-from"
+)
+
+// VerifyRule is a coverage rule checked by 'mdd verify', it has one of the forms:
+// req links-to att itst    : every req document must link to an att or itst document
+// adr linked-from mtg      : every adr document must be linked from a mtg document
+type VerifyRule struct {
+	Template  string
+	Direction string
+	Targets   []string
+}
+
+func ParseVerifyRule(s string) (VerifyRule, error) {
+	r := VerifyRule{}
+	fields := strings.Fields(s)
+	if len(fields) < 3 {
+		return r, fmt.Errorf("Invalid verify rule '%s', expected 'template %s|%s template...'", s, RuleLinksTo, RuleLinkedFrom)
+	}
+	r.Template = fields[0]
+	r.Direction = fields[1]
+	r.Targets = fields[2:]
+	if r.Direction != RuleLinksTo && r.Direction != RuleLinkedFrom {
+		return r, fmt.Errorf("Invalid verify rule '%s', expected '%s' or '%s' not '%s'", s, RuleLinksTo, RuleLinkedFrom, r.Direction)
+	}
+	return r, nil
+}
+
+func (r VerifyRule) String() string {
+	return fmt.Sprintf("%s %s %s", r.Template, r.Direction, strings.Join(r.Targets, " "))
+}
+
+// VerifyRules returns the rules in the project config
+func (p *Project) VerifyRules() ([]VerifyRule, error) {
+	rules := []VerifyRule{}
+	for _, s := range p.Config.Verify.Rules {
+		r, err := ParseVerifyRule(s)
+		if err != nil {
+			return rules, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// Check returns an error for each document that breaks the rule
+func (r VerifyRule) Check(p *Project) []error {
+	errs := []error{}
+	for _, d := range p.Documents {
+		if d.Template.Shortcut != r.Template {
+			continue
+		}
+		found := false
+		if r.Direction == RuleLinksTo {
+			for _, name := range d.ChildrenNames() {
+				c := p.FindDocument(name)
+				if c != nil && hasTemplate(c, r.Targets) {
+					found = true
+					break
+				}
+			}
+		} else {
+			for _, name := range p.ParentNames(d) {
+				parent := p.FindDocument(name)
+				if parent != nil && hasTemplate(parent, r.Targets) {
+					found = true
+					break
+				}
+			}
+		}
+		if !found && r.Direction == RuleLinksTo {
+			errs = append(errs, newDocumentError(d.BaseFilename(), ErrCodeRule, "Document '%s' must link to one of: %s", d.BaseFilename(), strings.Join(r.Targets, ", ")))
+		} else if !found {
+			errs = append(errs, newDocumentError(d.BaseFilename(), ErrCodeRule, "Document '%s' must be linked from one of: %s", d.BaseFilename(), strings.Join(r.Targets, ", ")))
+		}
+	}
+	return errs
+}
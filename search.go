@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	SearchFilterTag      = "tag"
+	SearchFilterTemplate = "template"
+	SearchFilterStatus   = "status"
+
+	// Written by publish for the search box on the index page
+	SearchIndexFile = "search.json"
+
+	// Relative weight of a match in each part of a document
+	searchTitleWeight = 10
+	searchTagWeight   = 5
+	searchBodyWeight  = 1
+
+	// Number of characters either side of a match to include in a snippet
+	snippetContext = 40
+)
+
+// Query is a parsed search query, eg: '"user login" password tag:security template:req'
+// A document matches if it contains every term & phrase, and passes every filter
+type Query struct {
+	// Lower case words and phrases to match against the title, tags and body
+	Terms []string
+
+	// Filters, a document must have one of the values for each non empty filter
+	Tags      []string
+	Templates []string
+	Statuses  []string
+
+	// Where expression the document must match, or nil
+	Where *Filter
+}
+
+// SearchResult is a document matching a query, with a score used for ranking
+type SearchResult struct {
+	Doc     *Document
+	Score   int
+	Snippet string
+}
+
+var (
+	whitespaceRegex *regexp.Regexp
+	metaBlockRegex  *regexp.Regexp
+)
+
+func init() {
+	whitespaceRegex = regexp.MustCompile("\\s+")
+	metaBlockRegex = regexp.MustCompile("(?ms)^\\s*<!-- mdd\\s*$.*?^\\s*-->\\s*$")
+}
+
+// ParseQuery splits s into terms and filters, text between double quotes is a
+// single phrase term
+func ParseQuery(s string) (Query, error) {
+	q := Query{}
+	tokens := []string{}
+	for i, part := range strings.Split(s, "\"") {
+		if i%2 == 1 {
+			// Inside quotes
+			if phrase := strings.TrimSpace(part); phrase != "" {
+				q.Terms = append(q.Terms, strings.ToLower(phrase))
+			}
+		} else {
+			tokens = append(tokens, strings.Fields(part)...)
+		}
+	}
+	if strings.Count(s, "\"")%2 == 1 {
+		return q, fmt.Errorf("Unterminated phrase in query '%s'", s)
+	}
+
+	for _, t := range tokens {
+		kv := strings.SplitN(t, ":", 2)
+		if len(kv) == 2 {
+			switch kv[0] {
+			case SearchFilterTag:
+				q.Tags = append(q.Tags, kv[1])
+				continue
+			case SearchFilterTemplate:
+				q.Templates = append(q.Templates, kv[1])
+				continue
+			case SearchFilterStatus:
+				q.Statuses = append(q.Statuses, kv[1])
+				continue
+			}
+		}
+		q.Terms = append(q.Terms, strings.ToLower(t))
+	}
+	return q, nil
+}
+
+// Body returns the document contents without the metadata block
+func (d *Document) Body() string {
+	return metaBlockRegex.ReplaceAllString(string(d.raw), "")
+}
+
+// Match returns the documents score for the query, and false if it doesnt match
+func (q *Query) Match(d *Document) (int, bool) {
+	if len(q.Tags) > 0 && !containsAny(d.TagNames(), q.Tags) {
+		return 0, false
+	}
+	if len(q.Templates) > 0 && !containsAny([]string{d.Template.Shortcut}, q.Templates) {
+		return 0, false
+	}
+	if len(q.Statuses) > 0 && !containsAny([]string{d.Status}, q.Statuses) {
+		return 0, false
+	}
+	if q.Where != nil && !q.Where.Match(d) {
+		return 0, false
+	}
+
+	title := strings.ToLower(d.Title)
+	body := strings.ToLower(whitespaceRegex.ReplaceAllString(d.Body(), " "))
+	score := 0
+	for _, term := range q.Terms {
+		termScore := searchTitleWeight*strings.Count(title, term) + searchBodyWeight*strings.Count(body, term)
+		for _, tag := range d.TagNames() {
+			if strings.Contains(strings.ToLower(tag), term) {
+				termScore += searchTagWeight
+			}
+		}
+		if termScore == 0 {
+			return 0, false
+		}
+		score += termScore
+	}
+	return score, true
+}
+
+func containsAny(values, wanted []string) bool {
+	for _, v := range values {
+		for _, w := range wanted {
+			if v == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Snippet returns the text around the first match in the body, with every
+// term in it passed through highlight
+func (q *Query) Snippet(d *Document, highlight func(string) string) string {
+	body := []rune(strings.TrimSpace(whitespaceRegex.ReplaceAllString(d.Body(), " ")))
+	// Lower case each rune, so offsets in lower are offsets in body, even
+	// where the lower case form has a different length in bytes
+	lower := make([]rune, len(body))
+	for i, r := range body {
+		lower[i] = unicode.ToLower(r)
+	}
+	lowerText := string(lower)
+	start := -1
+	for _, term := range q.Terms {
+		if i := strings.Index(lowerText, term); i >= 0 {
+			if i = utf8.RuneCountInString(lowerText[:i]); start < 0 || i < start {
+				start = i
+			}
+		}
+	}
+	if start < 0 {
+		return ""
+	}
+
+	from := start - snippetContext
+	if from < 0 {
+		from = 0
+	}
+	to := start + snippetContext
+	for _, term := range q.Terms {
+		length := utf8.RuneCountInString(term)
+		if strings.HasPrefix(string(lower[start:]), term) && start+length+snippetContext > to {
+			to = start + length + snippetContext
+		}
+	}
+	if to > len(body) {
+		to = len(body)
+	}
+
+	// Highlight all the terms in one pass, longest first, so highlights never nest
+	terms := append([]string{}, q.Terms...)
+	sort.Slice(terms, func(i, j int) bool { return len(terms[i]) > len(terms[j]) })
+	for i, term := range terms {
+		terms[i] = regexp.QuoteMeta(term)
+	}
+	r := regexp.MustCompile("(?i)" + strings.Join(terms, "|"))
+	snippet := r.ReplaceAllStringFunc(string(body[from:to]), highlight)
+	if from > 0 {
+		snippet = "..." + snippet
+	}
+	if to < len(body) {
+		snippet = snippet + "..."
+	}
+	return snippet
+}
+
+// Search returns the documents matching q, highest score first
+func (p *Project) Search(q Query, highlight func(string) string) []SearchResult {
+	results := []SearchResult{}
+	for _, d := range p.Documents {
+		if score, ok := q.Match(d); ok {
+			results = append(results, SearchResult{Doc: d, Score: score, Snippet: q.Snippet(d, highlight)})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Doc.BaseFilename() < results[j].Doc.BaseFilename()
+	})
+	return results
+}
+
+// terminalHighlight makes text bold on a terminal, and wraps it in '**' otherwise
+func terminalHighlight(s string) string {
+	if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		return "\x1b[1m" + s + "\x1b[0m"
+	}
+	return "**" + s + "**"
+}
+
+// SearchIndexEntry is one document in the search index used by the published site
+type SearchIndexEntry struct {
+	HtmlFilename string   `json:"html"`
+	BaseFilename string   `json:"filename"`
+	Title        string   `json:"title"`
+	Template     string   `json:"template"`
+	Status       string   `json:"status"`
+	Tags         []string `json:"tags"`
+	Body         string   `json:"body"`
+}
+
+// SearchIndex returns the entries written to search.json when publishing
+func (p *Project) SearchIndex() []SearchIndexEntry {
+	index := []SearchIndexEntry{}
+	for _, d := range p.Documents {
+		index = append(index, SearchIndexEntry{
+			HtmlFilename: d.HtmlFilename(),
+			BaseFilename: d.BaseFilename(),
+			Title:        d.Title,
+			Template:     d.Template.Shortcut,
+			Status:       d.Status,
+			Tags:         d.TagNames(),
+			Body:         strings.TrimSpace(whitespaceRegex.ReplaceAllString(d.Body(), " ")),
+		})
+	}
+	return index
+}
+
+// WriteSearchIndex writes the search index as JSON to outPath/search.json
+func (p *Project) WriteSearchIndex(outPath string) error {
+	b, err := json.Marshal(p.SearchIndex())
+	if err != nil {
+		return err
+	}
+	return writeFileIfChanged(filepath.Join(outPath, SearchIndexFile), b)
+}
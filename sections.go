@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	MetadataSection = "mdd-section"
+	SectionRequired = "required"
+	SectionOptional = "optional"
+
+	ErrCodeSection = "section"
+)
+
+// Section is a heading a template expects documents to have, declared as
+// 'mdd-section: required Context' or 'mdd-section: optional Notes'
+type Section struct {
+	Heading  string
+	Required bool
+}
+
+// documentSection is a heading in a document, and the number of non blank
+// lines before the next heading of the same or a higher level
+type documentSection struct {
+	Heading string
+	Level   int
+	Lines   int
+}
+
+var (
+	headingRegex *regexp.Regexp
+	fenceRegex   *regexp.Regexp
+)
+
+func init() {
+	headingRegex = regexp.MustCompile("^(#{1,6})\\s+(.*?)[\\s#]*$")
+	fenceRegex = regexp.MustCompile("^\\s*(```|~~~)")
+}
+
+// parseSection parses a template section of the form 'required|optional heading'
+func (t *Template) parseSection(value string) error {
+	words := strings.SplitN(value, " ", 2)
+	if len(words) != 2 || (words[0] != SectionRequired && words[0] != SectionOptional) || strings.TrimSpace(words[1]) == "" {
+		return fmt.Errorf("Template '%s' invalid section '%s', expected '%s|%s heading'", t.Filename, value, SectionRequired, SectionOptional)
+	}
+	s := Section{Heading: strings.TrimSpace(words[1]), Required: words[0] == SectionRequired}
+	if t.FindSection(s.Heading) != nil {
+		return fmt.Errorf("Template '%s' section '%s' declared twice", t.Filename, s.Heading)
+	}
+	t.Sections = append(t.Sections, s)
+	return nil
+}
+
+// FindSection returns the section declared by the template, or nil. Headings
+// are compared ignoring case
+func (t *Template) FindSection(heading string) *Section {
+	for i := range t.Sections {
+		if strings.EqualFold(t.Sections[i].Heading, heading) {
+			return &t.Sections[i]
+		}
+	}
+	return nil
+}
+
+// sections returns the headings in the document body, in order, ignoring any
+// in fenced code blocks
+func (d *Document) sections() []documentSection {
+	sections := []documentSection{}
+	// Index into sections of the headings whose content is still being counted
+	open := []int{}
+	inFence := false
+	for _, l := range strings.Split(d.Body(), LineBreak) {
+		if fenceRegex.MatchString(l) {
+			inFence = !inFence
+		} else if matches := headingRegex.FindStringSubmatch(l); matches != nil && !inFence {
+			level := len(matches[1])
+			// The heading ends the sections at the same or a lower level
+			for len(open) > 0 && sections[open[len(open)-1]].Level >= level {
+				open = open[:len(open)-1]
+			}
+			for _, i := range open {
+				sections[i].Lines++
+			}
+			sections = append(sections, documentSection{Heading: matches[2], Level: level})
+			open = append(open, len(sections)-1)
+			continue
+		}
+		if strings.TrimSpace(l) != "" {
+			for _, i := range open {
+				sections[i].Lines++
+			}
+		}
+	}
+	return sections
+}
+
+// CheckSections returns an error for each required section missing from the
+// document, each empty section, and each section out of the template order
+func (p *Project) CheckSections(d *Document) []error {
+	errs := []error{}
+	if len(d.Template.Sections) == 0 {
+		return errs
+	}
+	found := d.sections()
+	previous := ""
+	previousIndex := -1
+	for _, s := range d.Template.Sections {
+		index := -1
+		for i, f := range found {
+			if strings.EqualFold(f.Heading, s.Heading) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			if s.Required {
+				errs = append(errs, newDocumentError(d.BaseFilename(), ErrCodeSection, "Document '%s' missing required section '%s'", d.BaseFilename(), s.Heading))
+			}
+			continue
+		}
+		if found[index].Lines == 0 {
+			errs = append(errs, newDocumentError(d.BaseFilename(), ErrCodeSection, "Document '%s' section '%s' is empty", d.BaseFilename(), s.Heading))
+		}
+		if index < previousIndex {
+			errs = append(errs, newDocumentError(d.BaseFilename(), ErrCodeSection, "Document '%s' section '%s' should come after '%s'", d.BaseFilename(), s.Heading, previous))
+			continue
+		}
+		previous = s.Heading
+		previousIndex = index
+	}
+	return errs
+}
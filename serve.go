@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Path of the server sent events stream that tells the browser to reload
+	EventsPath = "/_mdd/events"
+
+	// Injected into every page served, reloads the page when a document changes
+	reloadScript = `
+<script>
+new EventSource('` + EventsPath + `').onmessage = function() { location.reload(); };
+</script>
+`
+)
+
+// Server renders the project documents on demand
+type Server struct {
+	HomePath string
+	watcher  *watcher
+}
+
+// watcher polls a directory and signals when any file in it changes
+type watcher struct {
+	path string
+
+	mu        sync.Mutex
+	signature string
+	// Closed, and replaced, each time the directory changes
+	changed chan struct{}
+}
+
+func NewServer(p *Project, interval time.Duration) *Server {
+	w := &watcher{path: p.DocumentPath, changed: make(chan struct{})}
+	w.signature = w.scan()
+	go w.poll(interval)
+	return &Server{HomePath: p.HomePath, watcher: w}
+}
+
+// scan returns a string that changes whenever a file is added, removed or modified
+func (w *watcher) scan() string {
+	var sig bytes.Buffer
+	filepath.Walk(w.path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		fmt.Fprintf(&sig, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return sig.String()
+}
+
+func (w *watcher) poll(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		sig := w.scan()
+		w.mu.Lock()
+		if sig != w.signature {
+			w.signature = sig
+			close(w.changed)
+			w.changed = make(chan struct{})
+		}
+		w.mu.Unlock()
+	}
+}
+
+// Changed returns a channel that is closed on the next change
+func (w *watcher) Changed() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.changed
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == EventsPath {
+		s.serveEvents(w, r)
+		return
+	}
+
+	// Read the project on every request, so edits are always shown
+	p, err := ReadProject(s.HomePath, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	var page bytes.Buffer
+	switch name {
+	case "", IndexHTMLFile:
+		tmpl, err := p.htmlTemplate(IndexHTMLFile)
+		if err == nil {
+			err = tmpl.Execute(&page, p.ForIndexView())
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case SearchIndexFile:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p.SearchIndex())
+		return
+	case TraceHTMLFile:
+		m := p.TraceMatrix(p.Config.Publish.TraceRows, p.Config.Publish.TraceCols)
+		tmpl, err := p.htmlTemplate(TraceHTMLFile)
+		if err == nil {
+			err = tmpl.Execute(&page, m.ForView())
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		var doc *Document
+		for _, d := range p.Documents {
+			if d.HtmlFilename() == name {
+				doc = d
+				break
+			}
+		}
+		if doc == nil {
+			http.NotFound(w, r)
+			return
+		}
+		tmpl, err := p.htmlTemplate(DocumentHTMLFile)
+		if err == nil {
+			var b []byte
+			b, err = doc.Page(tmpl, p.ForIndexView().FilenameDocs)
+			page.Write(b)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Inject the script inside the body of a complete page
+	html := page.String()
+	if i := strings.LastIndex(html, "</body>"); i >= 0 {
+		html = html[:i] + reloadScript + html[i:]
+	} else {
+		html += reloadScript
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, html)
+}
+
+// serveEvents streams a server sent event each time a document changes
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+
+	for {
+		select {
+		case <-s.watcher.Changed():
+			fmt.Fprintf(w, "data: reload\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// ListenAndServe serves the project until an error occurs
+func (s *Server) ListenAndServe(addr string) error {
+	log.Printf("Serving %s on http://%s/", s.HomePath, addr)
+	return http.ListenAndServe(addr, s)
+}
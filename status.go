@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	StatusDraft      = "draft"
+	StatusProposed   = "proposed"
+	StatusAccepted   = "accepted"
+	StatusDeprecated = "deprecated"
+	StatusSuperseded = "superseded"
+)
+
+// Statuses are the lifecycle states a document may be in
+var Statuses = []string{StatusDraft, StatusProposed, StatusAccepted, StatusDeprecated, StatusSuperseded}
+
+func validStatus(status string) bool {
+	for _, s := range Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedTransitions returns the statuses a document following t can move to
+// from status. A template that declares no transitions allows any change, and
+// a document without a status is treated as a draft
+func (t *Template) AllowedTransitions(status string) []string {
+	if status == "" {
+		status = StatusDraft
+	}
+	if len(t.Transitions) == 0 {
+		allowed := []string{}
+		for _, s := range Statuses {
+			if s != status {
+				allowed = append(allowed, s)
+			}
+		}
+		return allowed
+	}
+	return t.Transitions[status]
+}
+
+// SetStatus moves the document to status, if its template allows the transition
+func (d *Document) SetStatus(status string) error {
+	if !validStatus(status) {
+		return fmt.Errorf("Unknown status '%s', expected one of: %s", status, strings.Join(Statuses, ", "))
+	}
+	if status == d.Status {
+		return nil
+	}
+	allowed := d.Template.AllowedTransitions(d.Status)
+	for _, s := range allowed {
+		if s == status {
+			d.Status = status
+			return nil
+		}
+	}
+	from := d.Status
+	if from == "" {
+		from = StatusDraft
+	}
+	if len(allowed) == 0 {
+		return fmt.Errorf("Document '%s' cant move from '%s', it is a final status", d.BaseFilename(), from)
+	}
+	return fmt.Errorf("Document '%s' cant move from '%s' to '%s', expected one of: %s", d.BaseFilename(), from, status, strings.Join(allowed, ", "))
+}
+
+// parseTransition parses a template transition of the form 'from -> to'
+func (t *Template) parseTransition(value string) error {
+	states := strings.Split(value, "->")
+	if len(states) != 2 {
+		return fmt.Errorf("Template '%s' invalid transition '%s', expected 'from -> to'", t.Filename, value)
+	}
+	from := strings.TrimSpace(states[0])
+	to := strings.TrimSpace(states[1])
+	if !validStatus(from) {
+		return fmt.Errorf("Template '%s' invalid transition '%s', unknown status '%s'", t.Filename, value, from)
+	}
+	if !validStatus(to) {
+		return fmt.Errorf("Template '%s' invalid transition '%s', unknown status '%s'", t.Filename, value, to)
+	}
+	t.Transitions[from] = append(t.Transitions[from], to)
+	return nil
+}
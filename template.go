@@ -11,20 +11,51 @@ import (
 type Template struct {
 	Filename string
 	Shortcut string
+	// Contents excludes the template metadata block
 	Contents []string
 	Title    string
+
+	// Template metadata
+	// Transitions maps a status to the statuses a document can move to from it
+	Transitions map[string][]string
+	// Fields are the custom metadata fields of documents following the template
+	Fields []Field
+	// Sections are the headings documents following the template should have
+	Sections []Section
 }
 
+const (
+	TemplateMetadataStart = "<!-- mdd-template"
+	MetadataTransition    = "mdd-transition"
+)
+
 // This structure is used for templates output
 type TemplateView struct {
 	Title string
 }
 
-var templateDesc *regexp.Regexp
+// PlaceholderView is the data for the placeholders in a template, eg: {{.Title}},
+// which are expanded when a document is created. Anything else between '{{' and
+// '}}' is left alone, so templates can contain code samples using braces
+type PlaceholderView struct {
+	Title    string
+	ID       string
+	Filename string
+	Author   string
+	Date     string
+	Project  string
+}
+
+var (
+	templateDesc       *regexp.Regexp
+	tmplMetaStartRegex *regexp.Regexp
+	placeholderRegex   *regexp.Regexp
+)
 
 func init() {
 	templateDesc = regexp.MustCompile("^[# ]*([\\w-. ~]+) *$")
-
+	tmplMetaStartRegex = regexp.MustCompile("^\\s*<!-- mdd-template\\s*$")
+	placeholderRegex = regexp.MustCompile("{{\\s*\\.(Title|ID|Filename|Author|Date|Project)\\s*}}")
 }
 
 func (t *Template) ForView() TemplateView {
@@ -34,7 +65,7 @@ func (t *Template) ForView() TemplateView {
 }
 
 func ReadTemplate(path string) (Template, error) {
-	t := Template{Filename: path}
+	t := Template{Filename: path, Transitions: make(map[string][]string)}
 
 	// Shortcut is the Base minus extension
 	base := filepath.Base(path)
@@ -45,7 +76,28 @@ func ReadTemplate(path string) (Template, error) {
 	if err != nil {
 		return t, err
 	}
-	t.Contents = strings.Split(string(content), "\n")
+	// Separate the template metadata from the contents copied into new documents
+	inMeta := false
+	for _, l := range strings.Split(string(content), "\n") {
+		if inMeta {
+			if metaEndRegex.MatchString(l) {
+				inMeta = false
+			} else if err := t.parseMetadata(l); err != nil {
+				return t, err
+			}
+		} else if tmplMetaStartRegex.MatchString(l) {
+			inMeta = true
+			// Drop the blank line separating the block from the contents
+			if n := len(t.Contents); n > 0 && strings.TrimSpace(t.Contents[n-1]) == "" {
+				t.Contents = t.Contents[:n-1]
+			}
+		} else {
+			t.Contents = append(t.Contents, l)
+		}
+	}
+	if inMeta {
+		return t, fmt.Errorf("Template '%s', template metadata block is not closed", path)
+	}
 
 	// First line that matches the regex, is the description
 	for _, l := range t.Contents {
@@ -62,3 +114,48 @@ func ReadTemplate(path string) (Template, error) {
 
 	return t, nil
 }
+
+// Expand returns the contents with the placeholders replaced by values from view
+func (t *Template) Expand(view PlaceholderView) []string {
+	values := map[string]string{
+		"Title":    view.Title,
+		"ID":       view.ID,
+		"Filename": view.Filename,
+		"Author":   view.Author,
+		"Date":     view.Date,
+		"Project":  view.Project,
+	}
+	contents := make([]string, len(t.Contents))
+	for i, l := range t.Contents {
+		contents[i] = placeholderRegex.ReplaceAllStringFunc(l, func(match string) string {
+			return values[placeholderRegex.FindStringSubmatch(match)[1]]
+		})
+	}
+	return contents
+}
+
+// line has one of the forms:
+// mdd-transition: from -> to
+// mdd-field: name type [required] [default=value]
+// mdd-section: required|optional heading
+func (t *Template) parseMetadata(line string) error {
+	if strings.TrimSpace(line) == "" {
+		return nil
+	}
+	meta := strings.SplitN(line, MetadataSeparator, 2)
+	if len(meta) != 2 {
+		return fmt.Errorf("Template '%s' expected 2 values from metadata '%s'", t.Filename, line)
+	}
+	key := strings.TrimSpace(meta[0])
+	value := strings.TrimSpace(meta[1])
+	switch key {
+	case MetadataTransition:
+		return t.parseTransition(value)
+	case MetadataField:
+		return t.parseField(value)
+	case MetadataSection:
+		return t.parseSection(value)
+	default:
+		return fmt.Errorf("Template '%s' unrecognised metadata tag '%s'", t.Filename, key)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	TraceHTMLFile = "trace.html"
+	TraceMark     = "X"
+
+	// Format that writes TraceHTMLFile to the publish directory
+	TraceHTML = "html"
+)
+
+// TraceFormats are the values accepted by 'mdd trace -format'
+var TraceFormats = []string{FormatText, FormatCSV, TraceHTML}
+
+var (
+	// Template shortcuts used as the matrix rows & columns unless told otherwise
+	DefaultTraceRows    = []string{"req", "nfr"}
+	DefaultTraceColumns = []string{"att", "itst"}
+)
+
+// TraceMatrix records which requirement documents (rows) are linked to which
+// test documents (columns), either directly or transitively
+type TraceMatrix struct {
+	Rows    []*Document
+	Columns []*Document
+
+	// Map from row filename -> column filename -> linked
+	Links map[string]map[string]bool
+}
+
+// This structure is used for templates output
+type TraceView struct {
+	Columns  []DocView
+	Rows     []TraceRowView
+	Covered  int
+	Total    int
+	Coverage string
+}
+
+type TraceRowView struct {
+	Doc   DocView
+	Marks []bool
+}
+
+// Reachable returns the set of document filenames reachable from d by following
+// child links, not including d itself unless there is a cycle back to it
+func (p *Project) Reachable(d *Document) map[string]bool {
+	docs := make(map[string]*Document, len(p.Documents))
+	for _, doc := range p.Documents {
+		docs[doc.BaseFilename()] = doc
+	}
+	seen := make(map[string]bool)
+	queue := d.ChildrenNames()
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if c, ok := docs[name]; ok {
+			queue = append(queue, c.ChildrenNames()...)
+		}
+	}
+	return seen
+}
+
+// TraceMatrix builds the matrix of rowTemplates documents against colTemplates
+// documents. A cell is marked if either document can reach the other through links
+func (p *Project) TraceMatrix(rowTemplates, colTemplates []string) TraceMatrix {
+	m := TraceMatrix{Links: make(map[string]map[string]bool)}
+	reach := make(map[string]map[string]bool)
+	for _, d := range p.Documents {
+		if hasTemplate(d, rowTemplates) {
+			m.Rows = append(m.Rows, d)
+		}
+		if hasTemplate(d, colTemplates) {
+			m.Columns = append(m.Columns, d)
+		}
+		reach[d.BaseFilename()] = p.Reachable(d)
+	}
+	for _, r := range m.Rows {
+		m.Links[r.BaseFilename()] = make(map[string]bool)
+		for _, c := range m.Columns {
+			if reach[r.BaseFilename()][c.BaseFilename()] || reach[c.BaseFilename()][r.BaseFilename()] {
+				m.Links[r.BaseFilename()][c.BaseFilename()] = true
+			}
+		}
+	}
+	return m
+}
+
+func hasTemplate(d *Document, shortcuts []string) bool {
+	for _, s := range shortcuts {
+		if d.Template.Shortcut == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Covered returns the number of rows linked to at least one column
+func (m *TraceMatrix) Covered() int {
+	covered := 0
+	for _, r := range m.Rows {
+		if len(m.Links[r.BaseFilename()]) > 0 {
+			covered++
+		}
+	}
+	return covered
+}
+
+// Coverage returns the percentage of rows linked to at least one column
+func (m *TraceMatrix) Coverage() float64 {
+	if len(m.Rows) == 0 {
+		return 100
+	}
+	return 100 * float64(m.Covered()) / float64(len(m.Rows))
+}
+
+func (m *TraceMatrix) CoverageSummary() string {
+	return fmt.Sprintf("Coverage: %d/%d (%.0f%%)", m.Covered(), len(m.Rows), m.Coverage())
+}
+
+func (m *TraceMatrix) ForView() TraceView {
+	v := TraceView{
+		Covered:  m.Covered(),
+		Total:    len(m.Rows),
+		Coverage: fmt.Sprintf("%.0f%%", m.Coverage()),
+	}
+	for _, c := range m.Columns {
+		v.Columns = append(v.Columns, c.ForView())
+	}
+	for _, r := range m.Rows {
+		row := TraceRowView{Doc: r.ForView()}
+		for _, c := range m.Columns {
+			row.Marks = append(row.Marks, m.Links[r.BaseFilename()][c.BaseFilename()])
+		}
+		v.Rows = append(v.Rows, row)
+	}
+	return v
+}
+
+// PrintText logs the matrix as plain text columns
+func (m *TraceMatrix) PrintText() {
+	if len(m.Columns) > 0 {
+		header := fmt.Sprintf("%-15s  %-30s", "", "")
+		for _, c := range m.Columns {
+			header = fmt.Sprintf("%s %-15s", header, c.BaseFilename())
+		}
+		log.Printf("%s", strings.TrimRight(header, " "))
+	}
+	for _, r := range m.Rows {
+		line := fmt.Sprintf("%-15s  %-30s", r.BaseFilename(), r.Title)
+		for _, c := range m.Columns {
+			mark := ""
+			if m.Links[r.BaseFilename()][c.BaseFilename()] {
+				mark = TraceMark
+			}
+			line = fmt.Sprintf("%s %-15s", line, mark)
+		}
+		log.Printf("%s", strings.TrimRight(line, " "))
+	}
+	log.Printf("%s", m.CoverageSummary())
+}
+
+// WriteCSV writes the matrix with a header row of column filenames
+func (m *TraceMatrix) WriteCSV(out io.Writer) error {
+	w := csv.NewWriter(out)
+	header := []string{"document", "title"}
+	for _, c := range m.Columns {
+		header = append(header, c.BaseFilename())
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	for _, r := range m.Rows {
+		record := []string{r.BaseFilename(), r.Title}
+		for _, c := range m.Columns {
+			mark := ""
+			if m.Links[r.BaseFilename()][c.BaseFilename()] {
+				mark = TraceMark
+			}
+			record = append(record, mark)
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// WriteTraceHTML writes the matrix to outPath/trace.html, replacing any existing file
+func (p *Project) WriteTraceHTML(m *TraceMatrix, outPath string) (string, error) {
+	html, err := p.renderHTMLTemplate(TraceHTMLFile, m.ForView())
+	if err != nil {
+		return "", err
+	}
+	outFile := filepath.Join(outPath, TraceHTMLFile)
+	return outFile, writeFileIfChanged(outFile, html)
+}
+
+// htmlTemplate parses the named template from the project, falling back to
+// the built in copy for projects created before the template existed
+func (p *Project) htmlTemplate(name string) (*template.Template, error) {
+	s, err := p.htmlTemplateSource(name)
+	if err != nil {
+		return nil, err
+	}
+	return template.New(name).Parse(string(s))
+}
+
+// htmlTemplateSource returns the contents of the named template
+func (p *Project) htmlTemplateSource(name string) ([]byte, error) {
+	tmplPath := filepath.Join(p.TemplatePath, name)
+	if fileExists(tmplPath) {
+		return ioutil.ReadFile(tmplPath)
+	}
+	return box.Bytes(name)
+}